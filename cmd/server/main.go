@@ -38,7 +38,23 @@ func main() {
 	log.Printf("  Port: %s\n", cfg.Port)
 	log.Printf("  TorrentsStatesFile: %s\n", cfg.TorrentsStatesFile)
 	log.Printf("  TorrentsDir: %s\n", cfg.TorrentsDir)
+	log.Printf("  SavePaths: %v\n", cfg.SavePaths)
 	log.Printf("  PieceCompletionDir: %s\n", cfg.PieceCompletionDir)
+	log.Printf("  MetadataTimeout: %s\n", cfg.MetadataTimeout)
+	log.Printf("  DownloadRateLimit: %d\n", cfg.DownloadRateLimit)
+	log.Printf("  UploadRateLimit: %d\n", cfg.UploadRateLimit)
+	log.Printf("  MaxActiveDownloads: %d\n", cfg.MaxActiveDownloads)
+	log.Printf("  MaxActiveSeeds: %d\n", cfg.MaxActiveSeeds)
+	log.Printf("  WatchDir: %s\n", cfg.WatchDir)
+	log.Printf("  WatchInterval: %s\n", cfg.WatchInterval)
+	log.Printf("  RSSFeedsFile: %s\n", cfg.RSSFeedsFile)
+	log.Printf("  SearchTimeout: %s\n", cfg.SearchTimeout)
+	log.Printf("  ListenPort: %d\n", cfg.ListenPort)
+	log.Printf("  DHT: %t, PEX: %t, uTP: %t, UPnP: %t\n", cfg.EnableDHT, cfg.EnablePEX, cfg.EnableUTP, cfg.EnableUPnP)
+	log.Printf("  Encryption: %s\n", cfg.Encryption)
+	log.Printf("  ExtraTrackers: %v\n", cfg.ExtraTrackers)
+	log.Printf("  BlocklistPath: %s\n", cfg.BlocklistPath)
+	log.Printf("  BlocklistReloadInterval: %s\n", cfg.BlocklistReloadInterval)
 
 	// Ожидаем сигнал для graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -73,16 +89,56 @@ func main() {
 	// Хранилище метаданных торрентов
 	pieceCompletionDir := cfg.PieceCompletionDir
 	// Инициализируем торрент-клиент
-	torrentClient, err := torrent.NewClient(clientBaseDir, pieceCompletionDir)
+	limits := torrent.RateLimits{Download: cfg.DownloadRateLimit, Upload: cfg.UploadRateLimit}
+	network := torrent.NetworkSettings{
+		ListenPort:              cfg.ListenPort,
+		DHT:                     cfg.EnableDHT,
+		PEX:                     cfg.EnablePEX,
+		UTP:                     cfg.EnableUTP,
+		UPnP:                    cfg.EnableUPnP,
+		Encryption:              cfg.Encryption,
+		Proxy:                   cfg.Proxy,
+		ExtraTrackers:           cfg.ExtraTrackers,
+		Blocklist:               cfg.BlocklistPath,
+		BlocklistReloadInterval: cfg.BlocklistReloadInterval,
+	}
+	log.Printf("  Proxy: %s\n", network.Redacted().Proxy)
+	torrentClient, err := torrent.NewClient(clientBaseDir, pieceCompletionDir, cfg.SavePaths, limits, network)
 	if err != nil {
 		log.Fatal("Failed to init torrent client:", err)
 	}
 
 	sm := torrent.NewTorrentStateManager(torrentStates)
-	torrentService := torrent.NewService(torrentClient, sm)
+	queueLimits := torrent.QueueLimits{MaxDownloads: cfg.MaxActiveDownloads, MaxSeeds: cfg.MaxActiveSeeds}
+	torrentService := torrent.NewService(torrentClient, sm, cfg.MetadataTimeout, queueLimits)
 	eventHandler := torrent.NewEventHandler(torrentService)
 	eventHandler.Start()
 
+	// Папка наблюдения за .torrent и .magnet файлами
+	var watchFolder *torrent.WatchFolder
+	if cfg.WatchDir != "" {
+		watchFolder = torrent.NewWatchFolder(torrentService, cfg.WatchDir, cfg.WatchInterval)
+		if err := watchFolder.Start(); err != nil {
+			log.Fatal("Failed to start watch folder:", err)
+		}
+	}
+
+	// RSS ленты с правилами автоматического добавления
+	feedManager := torrent.NewFeedManager(torrentService, cfg.RSSFeedsFile)
+	if err := feedManager.Start(); err != nil {
+		log.Fatal("Failed to start RSS feeds:", err)
+	}
+
+	// Поиск по Torznab индексаторам
+	indexers, err := torrent.ParseIndexers(cfg.TorznabIndexers)
+	if err != nil {
+		log.Fatal("Invalid TORZNAB_INDEXERS:", err)
+	}
+	for _, idx := range indexers {
+		log.Printf("  Indexer: %s\n", idx.Name)
+	}
+	searcher := torrent.NewSearcher(indexers, cfg.SearchTimeout)
+
 	// Периодически проверяем торренты и обновляем
 	ticker := time.NewTicker(30 * time.Second)
 	go func() {
@@ -128,7 +184,7 @@ func main() {
 					}
 				} else {
 					// После успешной конвертации
-					if err := sm.MarkAsConverted(t.InfoHash); err != nil {
+					if err := sm.MarkAsConverted(t.InfoHash, t.ConversionProfile); err != nil {
 						log.Printf("Failed to mark torrent as converted: %v", err)
 					} else {
 						log.Printf("Successfully converted torrent: %s", t.Name)
@@ -156,22 +212,72 @@ func main() {
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	router.Route("/api", func(api chi.Router) {
-		api.Use(middleware.Timeout(30*time.Second), httphelpers.ErrorHandler)
+		api.Use(httphelpers.ErrorHandler)
 		api.Route("/torrents", func(r chi.Router) {
-			r.Get("/", handlers.GetTorrentsHandler(torrentService))
-			r.Post("/", handlers.AddTorrentHandler(torrentService))
-			r.Get("/{hash}/pause", handlers.PauseTorrentHandler(torrentService))
-			r.Get("/{hash}/resume", handlers.ResumeTorrentHandler(torrentService))
-			r.Get("/{hash}", handlers.GetTorrentHandler(torrentService))
-			r.Delete("/{hash}", handlers.DeleteTorrentHandler(torrentService))
-			r.Post("/{hash}/convert", handlers.ConvertTorrentHandler(torrentService))
+			// Стриминг длится дольше таймаута API, поэтому регистрируется вне группы с таймаутом
+			r.Get("/{hash}/stream", handlers.StreamTorrentFileHandler(torrentService))
+			// Хеширование больших папок тоже может занять больше таймаута API
+			r.Post("/create", handlers.CreateTorrentHandler(torrentService))
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(30 * time.Second))
+				r.Get("/", handlers.GetTorrentsHandler(torrentService))
+				r.Post("/", handlers.AddTorrentHandler(torrentService))
+				r.Post("/preview", handlers.PreviewTorrentHandler(torrentService))
+				r.Get("/preview/{hash}", handlers.GetPreviewHandler(torrentService))
+				r.Post("/preview/{hash}/confirm", handlers.ConfirmPreviewHandler(torrentService))
+				r.Delete("/preview/{hash}", handlers.CancelPreviewHandler(torrentService))
+				r.Get("/{hash}/pause", handlers.PauseTorrentHandler(torrentService))
+				r.Get("/{hash}/resume", handlers.ResumeTorrentHandler(torrentService))
+				r.Get("/{hash}", handlers.GetTorrentHandler(torrentService))
+				r.Get("/{hash}/files", handlers.GetTorrentFilesHandler(torrentService))
+				r.Get("/{hash}/pieces", handlers.GetPieceMapHandler(torrentService))
+				r.Get("/{hash}/metainfo", handlers.GetMetaInfoHandler(torrentService))
+				r.Put("/{hash}/files/priorities", handlers.SetFilePrioritiesHandler(torrentService))
+				r.Put("/{hash}/limits", handlers.SetTorrentLimitsHandler(torrentService))
+				r.Put("/{hash}/download-mode", handlers.SetDownloadModeHandler(torrentService))
+				r.Delete("/{hash}", handlers.DeleteTorrentHandler(torrentService))
+				r.Post("/{hash}/move", handlers.MoveStorageHandler(torrentService))
+				r.Post("/{hash}/recheck", handlers.RecheckTorrentHandler(torrentService))
+				r.Get("/{hash}/trackers", handlers.GetTrackersHandler(torrentService))
+				r.Post("/{hash}/trackers", handlers.AddTrackersHandler(torrentService))
+				r.Delete("/{hash}/trackers", handlers.RemoveTrackersHandler(torrentService))
+				r.Post("/{hash}/reannounce", handlers.ReannounceHandler(torrentService))
+				r.Post("/{hash}/convert", handlers.ConvertTorrentHandler(torrentService))
+				r.Post("/{hash}/queue/up", handlers.MoveInQueueHandler(torrentService, -1))
+				r.Post("/{hash}/queue/down", handlers.MoveInQueueHandler(torrentService, 1))
+				r.Post("/{hash}/force-start", handlers.ForceStartHandler(torrentService, true))
+				r.Delete("/{hash}/force-start", handlers.ForceStartHandler(torrentService, false))
+			})
+		})
+		api.Group(func(api chi.Router) {
+			api.Use(middleware.Timeout(30 * time.Second))
+			api.Get("/files/tree", handlers.GetFilesTreeHandler(cfg))
+			api.Get("/files", handlers.GetFilesHandler(cfg))
+			api.Get("/video", handlers.VideoHandler(cfg))
+			api.Get("/limits", handlers.GetGlobalLimitsHandler(torrentService))
+			api.Put("/limits", handlers.SetGlobalLimitsHandler(torrentService))
+			api.Get("/queue", handlers.GetQueueHandler(torrentService))
+			api.Get("/client/settings", handlers.GetClientSettingsHandler(torrentService))
+			api.Get("/blocklist", handlers.GetBlocklistHandler(torrentService))
+			api.Post("/blocklist/reload", handlers.ReloadBlocklistHandler(torrentService))
+			api.Get("/health", handlers.HealthCheck(torrentClient))
+			api.Get("/search", handlers.SearchHandler(searcher))
+			api.Get("/search/indexers", handlers.GetIndexersHandler(searcher))
+			api.Get("/rss/feeds", handlers.GetFeedsHandler(feedManager))
+			api.Post("/rss/feeds", handlers.AddFeedHandler(feedManager))
+			api.Get("/rss/feeds/{id}", handlers.GetFeedHandler(feedManager))
+			api.Put("/rss/feeds/{id}", handlers.UpdateFeedHandler(feedManager))
+			api.Delete("/rss/feeds/{id}", handlers.DeleteFeedHandler(feedManager))
+			api.Post("/rss/feeds/{id}/refresh", handlers.RefreshFeedHandler(feedManager))
+			api.Post("/rss/feeds/{id}/test", handlers.TestFeedRuleHandler(feedManager))
+			api.Post("/rss/feeds/{id}/rules", handlers.AddFeedRuleHandler(feedManager))
+			api.Put("/rss/feeds/{id}/rules/{ruleID}", handlers.UpdateFeedRuleHandler(feedManager))
+			api.Delete("/rss/feeds/{id}/rules/{ruleID}", handlers.DeleteFeedRuleHandler(feedManager))
 		})
-		api.Get("/files/tree", handlers.GetFilesTreeHandler(cfg))
-		api.Get("/files", handlers.GetFilesHandler(cfg))
-		api.Get("/video", handlers.VideoHandler(cfg))
-		api.Get("/health", handlers.HealthCheck(torrentClient))
 	})
 	router.Get("/ws", handlers.HandleWebSocket(torrentService))
+	router.Get("/ws/torrents/{hash}/pieces", handlers.PiecesWebSocketHandler(torrentService))
 	router.Get("/starfield/*", handlers.StarfieldHandler("./web"))
 
 	// Создаем HTTP-сервер
@@ -194,7 +300,8 @@ func main() {
 		log.Println("Shutting down...")
 
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, cancelShutdown := context.WithTimeout(serverCtx, 30*time.Second)
+		defer cancelShutdown()
 
 		go func() {
 			<-shutdownCtx.Done()
@@ -214,6 +321,11 @@ func main() {
 		}
 
 		// Останавливаем компоненты
+		if watchFolder != nil {
+			watchFolder.Stop()
+		}
+		feedManager.Stop()
+		torrentService.Stop()
 		eventHandler.Stop()
 		sm.Stop()
 
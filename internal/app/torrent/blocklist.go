@@ -0,0 +1,413 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrNoBlocklist is returned when no blocklist file is configured.
+var ErrNoBlocklist = errors.New("blocklist is not configured")
+
+// emuleAllowLevel уровни доступа eMule выше этого значения разрешают адреса
+const emuleAllowLevel = 127
+
+// maxBlockedAddrs ограничивает число адресов, которые хранит один набор отклонённых адресов
+const maxBlockedAddrs = 1 << 16
+
+// BlocklistStatus состояние списка блокировки
+type BlocklistStatus struct {
+	Path   string `json:"path"`
+	Ranges int    `json:"ranges"`
+	// InvalidLines строки файла, которые не удалось разобрать и которые были пропущены
+	InvalidLines   int        `json:"invalidLines"`
+	LoadedAt       *time.Time `json:"loadedAt,omitempty"`
+	ReloadInterval string     `json:"reloadInterval"`
+	// Error ошибка последней загрузки, при ошибке продолжает действовать предыдущий список
+	Error string `json:"error,omitempty"`
+	// BlockedPeers сколько разных адресов было отклонено с момента запуска, включая DHT, PEX и входящие соединения.
+	// Адрес, отклонённый снова после сброса заполненного набора адресов, учитывается повторно.
+	BlockedPeers int64 `json:"blockedPeers"`
+}
+
+// blocklist список блокировки IP адресов для anacrolix, который можно перечитать без перезапуска клиента
+type blocklist struct {
+	path     string
+	interval time.Duration
+
+	mu           sync.RWMutex
+	ranges       []iplist.Range
+	invalidLines int
+	loadedAt     time.Time
+	err          error
+
+	// blocked и torrents хранят адреса, а не число проверок: anacrolix проверяет один и тот же адрес многократно
+	blockedMu sync.Mutex
+	blocked   *addrSet
+	// torrents адреса из ответов трекеров, отклонённые для каждого торрента
+	torrents map[metainfo.Hash]*addrSet
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+var _ iplist.Ranger = (*blocklist)(nil)
+
+// newBlocklist загружает список из файла, interval 0 отключает периодическую перезагрузку
+func newBlocklist(path string, interval time.Duration) (*blocklist, error) {
+	bl := &blocklist{
+		path:     path,
+		interval: interval,
+		blocked:  newAddrSet(),
+		torrents: make(map[metainfo.Hash]*addrSet),
+		stopChan: make(chan struct{}),
+	}
+	if err := bl.reload(); err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// Lookup реализует iplist.Ranger, поддерживаются только адреса IPv4
+func (bl *blocklist) Lookup(ip net.IP) (iplist.Range, bool) {
+	v4 := ip.To4()
+	if v4 == nil {
+		return iplist.Range{}, false
+	}
+
+	bl.mu.RLock()
+	ranges := bl.ranges
+	bl.mu.RUnlock()
+
+	// Первый диапазон, который заканчивается не раньше адреса
+	i := sort.Search(len(ranges), func(i int) bool {
+		return bytes.Compare(ranges[i].Last, v4) >= 0
+	})
+	if i == len(ranges) || bytes.Compare(ranges[i].First, v4) > 0 {
+		return iplist.Range{}, false
+	}
+
+	bl.blockedMu.Lock()
+	bl.blocked.add([4]byte(v4))
+	bl.blockedMu.Unlock()
+	return ranges[i], true
+}
+
+func (bl *blocklist) NumRanges() int {
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	return len(bl.ranges)
+}
+
+// reload перечитывает файл, при ошибке остаётся прежний список
+func (bl *blocklist) reload() error {
+	ranges, invalid, err := loadBlocklist(bl.path)
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	bl.err = err
+	if err != nil {
+		return err
+	}
+	bl.ranges = ranges
+	bl.invalidLines = invalid
+	bl.loadedAt = time.Now()
+	log.Printf("[torrent] Loaded %d blocklist ranges from %s (%d invalid lines skipped)", len(ranges), bl.path, invalid)
+	return nil
+}
+
+// run периодически перечитывает список, пока не вызван stop
+func (bl *blocklist) run() {
+	if bl.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(bl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bl.stopChan:
+			return
+		case <-ticker.C:
+			if err := bl.reload(); err != nil {
+				log.Printf("[torrent] Failed to reload blocklist %s: %v", bl.path, err)
+			}
+		}
+	}
+}
+
+func (bl *blocklist) stop() {
+	bl.stopOnce.Do(func() {
+		close(bl.stopChan)
+	})
+}
+
+func (bl *blocklist) status() BlocklistStatus {
+	bl.blockedMu.Lock()
+	blocked := bl.blocked.count()
+	bl.blockedMu.Unlock()
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	status := BlocklistStatus{
+		Path:           bl.path,
+		Ranges:         len(bl.ranges),
+		InvalidLines:   bl.invalidLines,
+		ReloadInterval: bl.interval.String(),
+		BlockedPeers:   blocked,
+	}
+	if !bl.loadedAt.IsZero() {
+		loadedAt := bl.loadedAt
+		status.LoadedAt = &loadedAt
+	}
+	if bl.err != nil {
+		status.Error = bl.err.Error()
+	}
+	return status
+}
+
+// filterPeers убирает заблокированных пиров и запоминает их адреса в статистике торрента
+func (bl *blocklist) filterPeers(hash metainfo.Hash, peers []torrent.PeerInfo) []torrent.PeerInfo {
+	allowed := peers[:0]
+	var rejected [][4]byte
+	for _, p := range peers {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			if _, blocked := bl.Lookup(addr.IP); blocked {
+				rejected = append(rejected, [4]byte(addr.IP.To4()))
+				continue
+			}
+		}
+		allowed = append(allowed, p)
+	}
+
+	if len(rejected) > 0 {
+		bl.blockedMu.Lock()
+		set := bl.torrents[hash]
+		if set == nil {
+			set = newAddrSet()
+			bl.torrents[hash] = set
+		}
+		for _, addr := range rejected {
+			set.add(addr)
+		}
+		bl.blockedMu.Unlock()
+	}
+	return allowed
+}
+
+// blockedPeers возвращает число разных адресов из ответов трекеров торрента, отклонённых списком блокировки
+func (bl *blocklist) blockedPeers(hash metainfo.Hash) int64 {
+	bl.blockedMu.Lock()
+	defer bl.blockedMu.Unlock()
+
+	if set := bl.torrents[hash]; set != nil {
+		return set.count()
+	}
+	return 0
+}
+
+// forget удаляет статистику удалённого из клиента торрента
+func (bl *blocklist) forget(hash metainfo.Hash) {
+	bl.blockedMu.Lock()
+	defer bl.blockedMu.Unlock()
+
+	delete(bl.torrents, hash)
+}
+
+// addrSet считает разные адреса, храня не больше maxBlockedAddrs из них. Заполненный набор сбрасывается,
+// а его размер переносится в счётчик, поэтому память не растёт на долго работающем клиенте.
+type addrSet struct {
+	addrs   map[[4]byte]struct{}
+	flushed int64
+}
+
+func newAddrSet() *addrSet {
+	return &addrSet{addrs: make(map[[4]byte]struct{})}
+}
+
+func (s *addrSet) add(addr [4]byte) {
+	if _, ok := s.addrs[addr]; ok {
+		return
+	}
+	if len(s.addrs) >= maxBlockedAddrs {
+		s.flushed += int64(len(s.addrs))
+		clear(s.addrs)
+	}
+	s.addrs[addr] = struct{}{}
+}
+
+// count возвращает число учтённых адресов, включая сброшенные
+func (s *addrSet) count() int64 {
+	return s.flushed + int64(len(s.addrs))
+}
+
+// loadBlocklist читает список в формате P2P или eMule DAT, сжатый gzip или нет.
+// Возвращает отсортированные диапазоны без пересечений и число пропущенных строк.
+func loadBlocklist(path string) ([]iplist.Range, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer filehelpers.CloseFile(file)
+
+	reader := bufio.NewReader(file)
+	var r io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var ranges []iplist.Range
+	invalid := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rng, ok, err := parseBlocklistLine(scanner.Text())
+		if err != nil {
+			invalid++
+			continue
+		}
+		if ok {
+			ranges = append(ranges, rng)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ranges) == 0 && invalid > 0 {
+		return nil, 0, fmt.Errorf("%s: no valid ranges, %d invalid lines", path, invalid)
+	}
+	return mergeRanges(ranges), invalid, nil
+}
+
+// parseBlocklistLine разбирает строку в формате P2P ("описание:1.2.3.0-1.2.3.255")
+// или eMule DAT ("001.002.003.000 - 001.002.003.255 , 000 , описание").
+// Пустые строки, комментарии и разрешающие записи eMule возвращают ok == false без ошибки.
+func parseBlocklistLine(line string) (iplist.Range, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+		return iplist.Range{}, false, nil
+	}
+
+	// Строка считается записью eMule, только если первые поля разбираются как диапазон и уровень доступа:
+	// описание P2P тоже может содержать дефисы и запятые
+	if fields := strings.Split(line, ","); len(fields) >= 2 {
+		first, last, spanErr := parseBlocklistSpan(fields[0])
+		level, levelErr := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if spanErr == nil && levelErr == nil {
+			if level > emuleAllowLevel {
+				return iplist.Range{}, false, nil
+			}
+			rng := iplist.Range{First: first, Last: last}
+			if len(fields) > 2 {
+				rng.Description = strings.TrimSpace(strings.Join(fields[2:], ","))
+			}
+			return rng, true, nil
+		}
+	}
+
+	colon := strings.LastIndex(line, ":")
+	if colon == -1 {
+		return iplist.Range{}, false, errors.New("missing colon")
+	}
+	first, last, err := parseBlocklistSpan(line[colon+1:])
+	if err != nil {
+		return iplist.Range{}, false, err
+	}
+	return iplist.Range{First: first, Last: last, Description: line[:colon]}, true, nil
+}
+
+// parseBlocklistSpan разбирает диапазон адресов вида "1.2.3.0-1.2.3.255"
+func parseBlocklistSpan(span string) (net.IP, net.IP, error) {
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return nil, nil, errors.New("missing hyphen")
+	}
+	first, err := parseBlocklistIP(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err := parseBlocklistIP(to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Compare(first, last) > 0 {
+		return nil, nil, fmt.Errorf("range %s-%s is reversed", first, last)
+	}
+	return first, last, nil
+}
+
+// parseBlocklistIP разбирает IPv4 адрес, допуская ведущие нули, которые используются в списках eMule
+func parseBlocklistIP(s string) (net.IP, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid IPv4 address %q", s)
+	}
+	ip := make(net.IP, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", s)
+		}
+		ip[i] = byte(v)
+	}
+	return ip, nil
+}
+
+// mergeRanges сортирует диапазоны и объединяет пересекающиеся, как того требует поиск в Lookup
+func mergeRanges(ranges []iplist.Range) []iplist.Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].First, ranges[j].First) < 0
+	})
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && bytes.Compare(r.First, merged[n-1].Last) <= 0 {
+			if bytes.Compare(r.Last, merged[n-1].Last) > 0 {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// ReloadBlocklist reads the blocklist file again. On error the previous list stays in effect.
+func (c *Client) ReloadBlocklist() error {
+	if c.blocklist == nil {
+		return ErrNoBlocklist
+	}
+	return c.blocklist.reload()
+}
+
+// BlocklistStatus returns the state of the blocklist.
+func (c *Client) BlocklistStatus() (BlocklistStatus, error) {
+	if c.blocklist == nil {
+		return BlocklistStatus{}, ErrNoBlocklist
+	}
+	return c.blocklist.status(), nil
+}
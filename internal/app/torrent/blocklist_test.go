@@ -0,0 +1,191 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	"github.com/anacrolix/torrent/iplist"
+)
+
+func TestParseBlocklistLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    iplist.Range
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name:   "p2p",
+			line:   "Bad peers:1.2.3.0-1.2.3.255",
+			want:   iplist.Range{First: net.IPv4(1, 2, 3, 0).To4(), Last: net.IPv4(1, 2, 3, 255).To4(), Description: "Bad peers"},
+			wantOK: true,
+		},
+		{
+			name:   "p2p description with colons",
+			line:   "  Evil: corp:10.0.0.1-10.0.0.1  ",
+			want:   iplist.Range{First: net.IPv4(10, 0, 0, 1).To4(), Last: net.IPv4(10, 0, 0, 1).To4(), Description: "Evil: corp"},
+			wantOK: true,
+		},
+		{
+			name:   "emule with leading zeros",
+			line:   "001.002.003.000 - 001.002.003.255 , 000 , Bad, peers",
+			want:   iplist.Range{First: net.IPv4(1, 2, 3, 0).To4(), Last: net.IPv4(1, 2, 3, 255).To4(), Description: "Bad, peers"},
+			wantOK: true,
+		},
+		{
+			name:   "emule at the allow level blocks",
+			line:   "005.000.000.000 - 005.000.000.255 , 127",
+			want:   iplist.Range{First: net.IPv4(5, 0, 0, 0).To4(), Last: net.IPv4(5, 0, 0, 255).To4()},
+			wantOK: true,
+		},
+		{
+			name:   "p2p description with a hyphen and a comma",
+			line:   "Foo-Bar, Inc:1.2.3.0-1.2.3.255",
+			want:   iplist.Range{First: net.IPv4(1, 2, 3, 0).To4(), Last: net.IPv4(1, 2, 3, 255).To4(), Description: "Foo-Bar, Inc"},
+			wantOK: true,
+		},
+		{
+			name:   "p2p description with a number after the comma",
+			line:   "Foo-Bar, 12:1.2.3.0-1.2.3.255",
+			want:   iplist.Range{First: net.IPv4(1, 2, 3, 0).To4(), Last: net.IPv4(1, 2, 3, 255).To4(), Description: "Foo-Bar, 12"},
+			wantOK: true,
+		},
+		{name: "emule allowed range is skipped", line: "005.000.000.000 - 005.000.000.255 , 128 , friends"},
+		{name: "empty line", line: "   "},
+		{name: "hash comment", line: "# generated list"},
+		{name: "slash comment", line: "// generated list"},
+		{name: "missing colon", line: "1.2.3.0-1.2.3.255", wantErr: true},
+		{name: "missing hyphen", line: "Bad:1.2.3.0", wantErr: true},
+		{name: "invalid address", line: "Bad:1.2.3-1.2.3.255", wantErr: true},
+		{name: "octet out of range", line: "Bad:1.2.3.256-1.2.3.255", wantErr: true},
+		{name: "ipv6 is not supported", line: "Bad:::1-::2", wantErr: true},
+		{name: "reversed range", line: "Bad:1.2.3.255-1.2.3.0", wantErr: true},
+		{name: "invalid emule level", line: "1.2.3.0 - 1.2.3.255 , high , Bad", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseBlocklistLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBlocklistLine(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("parseBlocklistLine(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !got.First.Equal(tt.want.First) || !got.Last.Equal(tt.want.Last) || got.Description != tt.want.Description {
+				t.Errorf("parseBlocklistLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	r := func(first, last string) iplist.Range {
+		return iplist.Range{First: net.ParseIP(first).To4(), Last: net.ParseIP(last).To4()}
+	}
+
+	tests := []struct {
+		name   string
+		ranges []iplist.Range
+		want   []iplist.Range
+	}{
+		{
+			name:   "sorted by first address",
+			ranges: []iplist.Range{r("9.0.0.0", "9.0.0.9"), r("1.0.0.0", "1.0.0.9")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.9"), r("9.0.0.0", "9.0.0.9")},
+		},
+		{
+			name:   "overlapping ranges are joined",
+			ranges: []iplist.Range{r("1.0.0.5", "1.0.0.20"), r("1.0.0.0", "1.0.0.9")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.20")},
+		},
+		{
+			name:   "nested range is absorbed",
+			ranges: []iplist.Range{r("1.0.0.0", "1.0.0.255"), r("1.0.0.10", "1.0.0.20")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.255")},
+		},
+		{
+			name:   "touching at one address",
+			ranges: []iplist.Range{r("1.0.0.0", "1.0.0.9"), r("1.0.0.9", "1.0.0.15")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.15")},
+		},
+		{
+			name:   "chain of overlaps",
+			ranges: []iplist.Range{r("1.0.0.20", "1.0.0.30"), r("1.0.0.0", "1.0.0.10"), r("1.0.0.10", "1.0.0.20"), r("2.0.0.0", "2.0.0.0")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.30"), r("2.0.0.0", "2.0.0.0")},
+		},
+		{
+			name:   "adjacent ranges stay apart",
+			ranges: []iplist.Range{r("1.0.0.0", "1.0.0.9"), r("1.0.0.10", "1.0.0.19")},
+			want:   []iplist.Range{r("1.0.0.0", "1.0.0.9"), r("1.0.0.10", "1.0.0.19")},
+		},
+		{
+			name: "no ranges",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeRanges(tt.ranges)
+			if len(got) != len(tt.want) {
+				t.Fatalf("mergeRanges() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].First.Equal(tt.want[i].First) || !got[i].Last.Equal(tt.want[i].Last) {
+					t.Errorf("range %d = %s-%s, want %s-%s", i, got[i].First, got[i].Last, tt.want[i].First, tt.want[i].Last)
+				}
+			}
+		})
+	}
+}
+
+func TestAddrSet(t *testing.T) {
+	addr := func(i int) [4]byte {
+		return [4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+
+	tests := []struct {
+		name      string
+		adds      []int
+		wantCount int64
+		wantKept  int
+	}{
+		{name: "empty"},
+		{name: "repeated address counts once", adds: []int{1, 2, 1, 1, 2}, wantCount: 2, wantKept: 2},
+		{name: "full set is kept", adds: seq(maxBlockedAddrs), wantCount: maxBlockedAddrs, wantKept: maxBlockedAddrs},
+		{
+			name:      "overflow flushes the set and keeps the count",
+			adds:      append(seq(maxBlockedAddrs), maxBlockedAddrs, maxBlockedAddrs+1, maxBlockedAddrs),
+			wantCount: maxBlockedAddrs + 2,
+			wantKept:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAddrSet()
+			for _, i := range tt.adds {
+				s.add(addr(i))
+			}
+			if got := s.count(); got != tt.wantCount {
+				t.Errorf("count() = %d, want %d", got, tt.wantCount)
+			}
+			if len(s.addrs) != tt.wantKept {
+				t.Errorf("kept %d addresses, want %d", len(s.addrs), tt.wantKept)
+			}
+		})
+	}
+}
+
+// seq возвращает числа от 0 до n-1
+func seq(n int) []int {
+	result := make([]int, n)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
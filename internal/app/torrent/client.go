@@ -17,18 +17,71 @@ import (
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
 )
 
 var _ io.Closer = (*Client)(nil)
 
 type Client struct {
-	tClient *torrent.Client
-	baseDir string
+	tClient         *torrent.Client
+	baseDir         string
+	pieceCompletion storage.PieceCompletion
+	// Папки сохранения отдельных торрентов
+	storage *storageDirs
+
+	// Ограничения скорости
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
+	throttle        *throttler
+
+	// Статистика обмена и анонсы на трекеры
+	sampler  *statsSampler
+	trackers *trackerManager
+
+	// Порядок загрузки частей и проверка данных
+	pieces   *pieceScheduler
+	rechecks *rechecks
+
+	// Сетевые параметры, с которыми создан клиент, и список блокировки IP адресов
+	network   NetworkSettings
+	blocklist *blocklist
+
+	// Торренты, добавленные только ради метаданных для предпросмотра
+	previews  map[metainfo.Hash]struct{}
+	previewMu sync.Mutex
 }
 
-func NewClient(clientBaseDir string, pieceCompletionDir string) (*Client, error) {
+// NewClient creates a torrent client that stores data in clientBaseDir.
+// savePaths are additional directories that torrents may be saved to or moved into.
+func NewClient(clientBaseDir string, pieceCompletionDir string, savePaths []string, limits RateLimits, network NetworkSettings) (*Client, error) {
 	config := torrent.NewDefaultClientConfig()
 
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	if err := network.Validate(); err != nil {
+		return nil, err
+	}
+	network.apply(config)
+	peerDialer, err := network.proxyDialer()
+	if err != nil {
+		return nil, err
+	}
+	var bl *blocklist
+	if network.Blocklist != "" {
+		if bl, err = newBlocklist(network.Blocklist, network.BlocklistReloadInterval); err != nil {
+			return nil, fmt.Errorf("failed to load blocklist: %w", err)
+		}
+		config.IPBlocklist = bl
+	}
+	// Ограничители меняются во время работы, поэтому клиент хранит их указатели
+	downloadLimiter := newRateLimiter(limits.Download)
+	uploadLimiter := newRateLimiter(limits.Upload)
+	config.DownloadRateLimiter = downloadLimiter
+	config.UploadRateLimiter = uploadLimiter
+	// Анонсы выполняет trackerManager, чтобы знать состояние трекеров
+	config.DisableTrackers = true
+
 	if err := os.MkdirAll(clientBaseDir, 0o700); err != nil {
 		return nil, err
 	}
@@ -36,13 +89,27 @@ func NewClient(clientBaseDir string, pieceCompletionDir string) (*Client, error)
 		return nil, err
 	}
 
+	roots := make([]string, 0, len(savePaths)+1)
+	for _, dir := range append([]string{clientBaseDir}, savePaths...) {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, abs)
+	}
+	dirs := newStorageDirs(roots)
+
 	pieceCompletion, err := storage.NewDefaultPieceCompletionForDir(pieceCompletionDir)
 	if err != nil {
 		return nil, err
 	}
 
 	opts := storage.NewFileClientOpts{
-		ClientBaseDir:   clientBaseDir,
+		ClientBaseDir:   roots[0],
+		TorrentDirMaker: dirs.torrentDir,
 		PieceCompletion: pieceCompletion,
 	}
 	storageClient := storage.NewFileOpts(opts)
@@ -52,11 +119,40 @@ func NewClient(clientBaseDir string, pieceCompletionDir string) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
+	if peerDialer != nil {
+		tClient.AddDialer(peerDialer)
+	}
 
-	return &Client{
-		tClient: tClient,
-		baseDir: clientBaseDir,
-	}, nil
+	throttle := newThrottler()
+	// Приостановленные и ждущие в очереди торренты не анонсируются
+	stopped := func(hash metainfo.Hash) bool {
+		return throttle.held(hash)&uploadHolds != 0
+	}
+	c := &Client{
+		tClient:         tClient,
+		baseDir:         clientBaseDir,
+		pieceCompletion: pieceCompletion,
+		storage:         dirs,
+		downloadLimiter: downloadLimiter,
+		uploadLimiter:   uploadLimiter,
+		throttle:        throttle,
+		sampler:         newStatsSampler(),
+		trackers:        newTrackerManager(tClient, stopped, config.HTTPProxy, peerDialer == nil, bl),
+		pieces:          newPieceScheduler(),
+		rechecks:        newRechecks(),
+		network:         network,
+		blocklist:       bl,
+		previews:        make(map[metainfo.Hash]struct{}),
+	}
+	go c.throttle.run(tClient)
+	go c.sampler.run(tClient)
+	go c.trackers.run()
+	go c.pieces.run(tClient)
+	if bl != nil {
+		go bl.run()
+	}
+
+	return c, nil
 }
 
 // getClientBaseDir returns the base directory of the client.
@@ -64,18 +160,37 @@ func (c *Client) getClientBaseDir() string {
 	return c.baseDir
 }
 
-// Add adds a torrent via magnet link or file path.
-func (c *Client) Add(magnet string) (string, error) {
+// ErrNoMetadata is returned for torrents whose metadata has not been received yet.
+var ErrNoMetadata = errors.New("torrent metadata is not available yet")
+
+// ErrFileNotFound is returned when a path does not refer to a file of the torrent.
+var ErrFileNotFound = errors.New("file not found in torrent")
+
+// Add adds a torrent via magnet link or file path and saves its data to savePath (see ResolveSavePath).
+// It neither waits for the metadata of magnet links (see WaitForInfo) nor starts the download (see ApplyFilePriorities).
+func (c *Client) Add(source string, savePath string) (string, error) {
 	var t *torrent.Torrent
 	var err error
 
-	if strings.HasPrefix(magnet, "magnet:") {
-		t, err = c.tClient.AddMagnet(magnet)
+	if strings.HasPrefix(source, "magnet:") {
+		var magnet metainfo.Magnet
+		magnet, err = metainfo.ParseMagnetUri(source)
+		if err != nil {
+			return "", err
+		}
+		c.dropPreview(magnet.InfoHash)
+		if savePath != "" {
+			c.setSavePath(magnet.InfoHash, savePath)
+		}
+		t, err = c.tClient.AddMagnet(source)
 	} else {
-		mi, err := metainfo.LoadFromFile(magnet)
+		var mi *metainfo.MetaInfo
+		mi, err = metainfo.LoadFromFile(source)
 		if err != nil {
 			return "", err
 		}
+		c.dropPreview(mi.HashInfoBytes())
+		c.setSavePath(mi.HashInfoBytes(), savePath)
 		t, err = c.tClient.AddTorrent(mi)
 	}
 
@@ -83,11 +198,118 @@ func (c *Client) Add(magnet string) (string, error) {
 		return "", err
 	}
 	if t == nil {
-		return "", fmt.Errorf("failed to add torrent: %s", magnet)
+		return "", fmt.Errorf("failed to add torrent: %s", source)
+	}
+	c.addExtraTrackers(t)
+	// Анонсы начинаются сразу, без ожидания очередной сверки трекеров
+	c.trackers.sync()
+
+	return t.InfoHash().String(), nil
+}
+
+// HasInfo reports whether the metadata of the torrent is already known.
+func (c *Client) HasInfo(infoHash string) bool {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	return ok && t.Info() != nil
+}
+
+// DisplayName returns the torrent name, which may come from the magnet link before metadata arrives.
+func (c *Client) DisplayName(infoHash string) string {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return infoHash
+	}
+	return t.Name()
+}
+
+// WaitForInfo blocks until the torrent metadata arrives, ctx is done or the torrent is closed.
+func (c *Client) WaitForInfo(ctx context.Context, infoHash string) error {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
 	}
 
+	select {
+	case <-t.GotInfo():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.Closed():
+		return fmt.Errorf("torrent %s was closed before metadata arrived", infoHash)
+	}
+}
+
+// ApplyFilePriorities sets the download priority of every file in a torrent with known metadata.
+// Files missing from priorities are downloaded with normal priority, unknown paths are ignored.
+func (c *Client) ApplyFilePriorities(infoHash string, priorities map[string]FilePriority) error {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return ErrNoMetadata
+	}
+
+	for _, f := range t.Files() {
+		prio, ok := priorities[f.DisplayPath()]
+		if !ok {
+			prio = FilePriorityNormal
+		}
+		f.SetPriority(toPiecePriority(prio))
+	}
+	// Сбрасываем приоритеты, выставленные DownloadAll, чтобы пропущенные файлы не загружались
+	t.CancelPieces(0, t.NumPieces())
+	c.pieces.reset(t.InfoHash())
+
+	return nil
+}
+
+// GetFiles returns the files of a torrent with their current priorities.
+func (c *Client) GetFiles(infoHash string) ([]TorrentFile, error) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+
+	baseDir := c.torrentDir(t.InfoHash())
+	files := make([]TorrentFile, 0, len(t.Files()))
+	for _, f := range t.Files() {
+		file := TorrentFile{
+			Path:      f.DisplayPath(),
+			Size:      f.Length(),
+			Completed: f.BytesCompleted(),
+			Priority:  fromPiecePriority(f.Priority()),
+			IsVideo:   filehelpers.IsVideoFile(f.DisplayPath()),
+		}
+		file.Progress = getPercent(file.Completed, file.Size)
+		if file.IsVideo {
+			file.Playlist = hlsPlaylist(diskPath(baseDir, t, f), "")
+			file.HLSExists = file.Playlist != ""
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// AddMetaInfo adds a torrent from already parsed metainfo without starting the download.
+func (c *Client) AddMetaInfo(mi *metainfo.MetaInfo, savePath string) (string, error) {
+	c.dropPreview(mi.HashInfoBytes())
+	c.setSavePath(mi.HashInfoBytes(), savePath)
+	t, err := c.tClient.AddTorrent(mi)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return "", errors.New("failed to add torrent from metainfo")
+	}
+	c.addExtraTrackers(t)
+	// Анонсы начинаются сразу, без ожидания очередной сверки трекеров
+	c.trackers.sync()
+
 	<-t.GotInfo()
-	t.DownloadAll()
 
 	return t.InfoHash().String(), nil
 }
@@ -97,6 +319,9 @@ func (c *Client) toTorrent(t *torrent.Torrent) (*Torrent, error) {
 	if t == nil {
 		return nil, errors.New("cannot convert nil torrent")
 	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
 
 	metaInfo := t.Metainfo()
 	magnet, err := metaInfo.MagnetV2()
@@ -105,10 +330,18 @@ func (c *Client) toTorrent(t *torrent.Torrent) (*Torrent, error) {
 	}
 
 	infoHash := t.InfoHash().String()
-	done := t.BytesCompleted() == t.Length()
-	percent := getPercent(t.BytesCompleted(), t.Length())
+	selected, completed := selectedBytes(t)
+	done := selected > 0 && completed == selected
+	percent := getPercent(completed, selected)
 	state := StateDownloading
-	if done {
+	held := c.throttle.held(t.InfoHash())
+	effective := c.effectiveLimits(t.InfoHash())
+	switch {
+	case held&holdPaused != 0:
+		state = StatePaused
+	case held&holdQueued != 0:
+		state = StateQueued
+	case done:
 		state = StateCompleted
 	}
 
@@ -117,6 +350,10 @@ func (c *Client) toTorrent(t *torrent.Torrent) (*Torrent, error) {
 		Name:              t.Name(),
 		Magnet:            magnet.String(),
 		Size:              t.Length(),
+		SelectedSize:      selected,
+		SavePath:          c.storage.get(t.InfoHash()),
+		EffectiveLimits:   &effective,
+		Stats:             c.transferStats(t, selected, completed),
 		Done:              done,
 		DownloadedPercent: percent,
 		State:             state,
@@ -141,7 +378,14 @@ func (c *Client) GetTorrents() []Torrent {
 	torrents := make([]Torrent, 0, len(activeTorrents))
 
 	for _, t := range activeTorrents {
+		if c.isPreview(t.InfoHash()) {
+			continue
+		}
 		converted, err := c.toTorrent(t)
+		if errors.Is(err, ErrNoMetadata) {
+			// Метаданные ещё загружаются, состояние хранит StateManager
+			continue
+		}
 		if err != nil {
 			log.Printf("[client] error converting torrent: %v", err)
 			continue
@@ -154,25 +398,55 @@ func (c *Client) GetTorrents() []Torrent {
 // GetTorrentVideoFiles returns a list of video files for a torrent.
 func (c *Client) GetTorrentVideoFiles(t *torrent.Torrent) ([]string, error) {
 	var videoFiles []string
-	baseDir := c.getClientBaseDir()
-	torrentName := t.Name()
+	baseDir := c.torrentDir(t.InfoHash())
 
 	for _, file := range t.Files() {
+		if file.Priority() == torrent.PiecePriorityNone {
+			// Пропущенные файлы не загружаются
+			continue
+		}
 		if filehelpers.IsVideoFile(file.DisplayPath()) {
-			var fullPath string
-			if filehelpers.IsVideoFile(torrentName) {
-				fullPath = filepath.Join(baseDir, file.DisplayPath())
-			} else {
-				// if file in folder
-				fullPath = filepath.Join(baseDir, torrentName, file.DisplayPath())
-			}
-			videoFiles = append(videoFiles, fullPath)
+			videoFiles = append(videoFiles, diskPath(baseDir, t, file))
 		}
 	}
 
 	return videoFiles, nil
 }
 
+// diskPath возвращает путь к файлу торрента на диске
+func diskPath(baseDir string, t *torrent.Torrent, file *torrent.File) string {
+	if filehelpers.IsVideoFile(t.Name()) {
+		return filepath.Join(baseDir, file.DisplayPath())
+	}
+	// if file in folder
+	return filepath.Join(baseDir, t.Name(), file.DisplayPath())
+}
+
+// hlsPlaylist возвращает путь к плейлисту HLS видео или пустую строку, если его нет на диске
+func hlsPlaylist(video string, profile ConversionProfile) string {
+	p, ok := playlistProfile(video, profile)
+	if !ok {
+		return ""
+	}
+	return p.playlist(video)
+}
+
+// playlistProfile возвращает профиль, плейлист которого есть на диске для видео.
+// Плейлист лежит рядом с видео или в папке сегментов в зависимости от профиля конвертации,
+// при неизвестном профиле проверяются все варианты.
+func playlistProfile(video string, profile ConversionProfile) (ConversionProfile, bool) {
+	profiles := []ConversionProfile{ConversionCopy, ConversionAdaptive, ConversionTranscode}
+	if profile != "" {
+		profiles = []ConversionProfile{profile}
+	}
+	for _, p := range profiles {
+		if _, err := os.Stat(p.playlist(video)); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
 // GetTorrentVideoFilesInfo retrieves information about all video files in a torrent concurrently.
 func (c *Client) GetTorrentVideoFilesInfo(localTorrent *Torrent) ([]VideoFile, error) {
 	if localTorrent == nil {
@@ -184,6 +458,9 @@ func (c *Client) GetTorrentVideoFilesInfo(localTorrent *Torrent) ([]VideoFile, e
 	if !ok {
 		return nil, fmt.Errorf("torrent with infohash %s not found in client", localTorrent.InfoHash)
 	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
 
 	torrentVideoFiles, err := c.GetTorrentVideoFiles(t)
 	if err != nil {
@@ -206,6 +483,7 @@ func (c *Client) GetTorrentVideoFilesInfo(localTorrent *Torrent) ([]VideoFile, e
 				Path:      path,
 				VideoInfo: info,
 				Error:     err,
+				Playlist:  hlsPlaylist(path, localTorrent.ConvertedProfile),
 			}
 			if err != nil {
 				log.Printf("[client] Error getting video info for %s: %v", path, err)
@@ -217,17 +495,37 @@ func (c *Client) GetTorrentVideoFilesInfo(localTorrent *Torrent) ([]VideoFile, e
 	return results, nil
 }
 
-// PauseTorrent pauses a torrent's download.
+// PauseTorrent stops the data exchange of a torrent while keeping it loaded in the client.
 func (c *Client) PauseTorrent(infoHash string) error {
 	hash := metainfo.NewHashFromHex(infoHash)
 	t, ok := c.tClient.Torrent(hash)
 	if !ok {
 		return fmt.Errorf("torrent with infohash %s not found", infoHash)
 	}
-	t.Drop()
+	c.throttle.hold(t, holdPaused)
+	// Трекерам сразу отправляется stopped, чтобы они перестали раздавать адрес клиента
+	c.trackers.sync()
 	return nil
 }
 
+// ResumeTorrent allows a paused torrent to exchange data again.
+func (c *Client) ResumeTorrent(infoHash string) error {
+	hash := metainfo.NewHashFromHex(infoHash)
+	t, ok := c.tClient.Torrent(hash)
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found", infoHash)
+	}
+	c.throttle.unhold(t, holdPaused)
+	c.trackers.sync()
+	return nil
+}
+
+// HasTorrent reports whether the torrent is loaded in the client.
+func (c *Client) HasTorrent(infoHash string) bool {
+	_, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	return ok
+}
+
 // DeleteTorrent removes a torrent from the client.
 func (c *Client) DeleteTorrent(infoHash string) error {
 	hash := metainfo.NewHashFromHex(infoHash)
@@ -237,6 +535,13 @@ func (c *Client) DeleteTorrent(infoHash string) error {
 		return nil
 	}
 	t.Drop()
+	c.throttle.forget(hash)
+	c.pieces.forget(hash)
+	c.rechecks.forget(hash)
+	c.storage.forget(hash)
+	if c.blocklist != nil {
+		c.blocklist.forget(hash)
+	}
 	return nil
 }
 
@@ -254,6 +559,14 @@ func (c *Client) Close() error {
 	}()
 
 	log.Println("[torrent] Initiating graceful shutdown...")
+	c.throttle.stop()
+	c.sampler.stop()
+	c.trackers.stop()
+	c.pieces.stop()
+	c.rechecks.stop()
+	if c.blocklist != nil {
+		c.blocklist.stop()
+	}
 	c.tClient.Close()
 	log.Println("[torrent] Shutdown completed")
 
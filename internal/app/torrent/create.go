@@ -0,0 +1,250 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrInvalidCreateOptions is returned for torrent creation options that can't be used.
+var ErrInvalidCreateOptions = errors.New("invalid torrent creation options")
+
+const (
+	// minPieceLength и maxPieceLength допустимые размеры части создаваемого торрента
+	minPieceLength = 16 << 10
+	maxPieceLength = 64 << 20
+	// createdBy записывается в создаваемые .torrent файлы
+	createdBy = "GoFlix"
+)
+
+// CreateOptions параметры создания торрента из файлов библиотеки
+type CreateOptions struct {
+	// Path файл или папка внутри одной из папок сохранения, относительный путь отсчитывается от папки торрентов
+	Path string `json:"path"`
+	// Trackers трекеры, каждый на своём уровне в указанном порядке
+	Trackers []string `json:"trackers,omitempty"`
+	// WebSeeds адреса веб-сидов (BEP 19)
+	WebSeeds []string `json:"webSeeds,omitempty"`
+	// PieceLength размер части в байтах, степень двойки, 0 — подбирается по размеру данных
+	PieceLength int64  `json:"pieceLength,omitempty"`
+	Private     bool   `json:"private,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// Validate проверяет параметры создания торрента
+func (o CreateOptions) Validate() error {
+	if strings.TrimSpace(o.Path) == "" {
+		return fmt.Errorf("path is required: %w", ErrInvalidCreateOptions)
+	}
+	if o.PieceLength != 0 && (o.PieceLength < minPieceLength || o.PieceLength > maxPieceLength || o.PieceLength&(o.PieceLength-1) != 0) {
+		return fmt.Errorf("piece length must be a power of two between %d and %d: %w", minPieceLength, maxPieceLength, ErrInvalidCreateOptions)
+	}
+	for _, u := range o.Trackers {
+		if err := ValidateTrackerURL(u); err != nil {
+			return err
+		}
+	}
+	for _, u := range o.WebSeeds {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("web seed %s must be an http(s) URL: %w", u, ErrInvalidCreateOptions)
+		}
+	}
+	return nil
+}
+
+// CreatedTorrent результат создания торрента
+type CreatedTorrent struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	Magnet   string `json:"magnet"`
+	// MetaInfoURL адрес для скачивания .torrent файла
+	MetaInfoURL string `json:"metainfoUrl"`
+}
+
+// libraryPath возвращает абсолютный путь к данным и папку сохранения торрента, в которой они лежат
+func (c *Client) libraryPath(path string) (string, string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.storage.roots[0], path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	// Папка сохранения — родительская папка данных, сами данные становятся содержимым торрента
+	savePath, err := c.ResolveSavePath(filepath.Dir(abs))
+	if err != nil {
+		return "", "", err
+	}
+	// Символическая ссылка внутри библиотеки не должна открывать доступ к файлам вне её
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if !c.insideStorageRoots(resolved) {
+		return "", "", fmt.Errorf("%s: %w", path, ErrSavePathNotAllowed)
+	}
+	return abs, savePath, nil
+}
+
+// insideStorageRoots проверяет, что путь без символических ссылок лежит внутри одного из корней хранилища
+func (c *Client) insideStorageRoots(resolved string) bool {
+	for _, root := range c.storage.roots {
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+		if checkInsideDir(root, resolved) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildMetaInfo hashes a file or folder of the library and returns the metainfo of a new torrent
+// together with the save path that holds its data. It can take a while for large folders.
+func (c *Client) BuildMetaInfo(opts CreateOptions) (*metainfo.MetaInfo, string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+	root, savePath, err := c.libraryPath(opts.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	info := metainfo.Info{
+		Name:        filepath.Base(root),
+		PieceLength: opts.PieceLength,
+	}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+	if err := collectLibraryFiles(root, &info); err != nil {
+		return nil, "", err
+	}
+	if info.TotalLength() == 0 {
+		return nil, "", fmt.Errorf("%s has no data to share: %w", opts.Path, ErrInvalidCreateOptions)
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = metainfo.ChoosePieceLength(info.TotalLength())
+	}
+	err = info.GeneratePieces(func(fi metainfo.FileInfo) (io.ReadCloser, error) {
+		if len(info.Files) == 0 {
+			return os.Open(root)
+		}
+		return os.Open(filepath.Join(root, filepath.Join(fi.BestPath()...)))
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to hash %s: %w", opts.Path, err)
+	}
+
+	mi := &metainfo.MetaInfo{
+		CreationDate: time.Now().Unix(),
+		CreatedBy:    createdBy,
+		Comment:      opts.Comment,
+		UrlList:      opts.WebSeeds,
+	}
+	for _, u := range opts.Trackers {
+		mi.AnnounceList = append(mi.AnnounceList, []string{u})
+	}
+	if len(opts.Trackers) > 0 {
+		mi.Announce = opts.Trackers[0]
+	}
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		return nil, "", err
+	}
+
+	// Данные уже проверены хешированием, поэтому части сразу отмечаются загруженными и раздача начинается без проверки
+	hash := mi.HashInfoBytes()
+	for i := range info.NumPieces() {
+		if err := c.pieceCompletion.Set(metainfo.PieceKey{InfoHash: hash, Index: i}, true); err != nil {
+			return nil, "", err
+		}
+	}
+	return mi, savePath, nil
+}
+
+// collectLibraryFiles заполняет список файлов торрента, пропуская скрытые файлы
+// и результаты конвертации видео, лежащие рядом с ними
+func collectLibraryFiles(root string, info *metainfo.Info) error {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		info.Length = stat.Size()
+		return nil
+	}
+
+	var files []string
+	skip := make(map[string]struct{})
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+			if filehelpers.IsVideoFile(path) {
+				for _, output := range hlsOutputs(path, "") {
+					skip[output] = struct{}{}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if isHLSOutput(root, path, skip) {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		info.Files = append(info.Files, metainfo.FileInfo{
+			Path:   strings.Split(rel, string(filepath.Separator)),
+			Length: fi.Size(),
+		})
+	}
+	if len(info.Files) == 0 {
+		return fmt.Errorf("%s has no files to share: %w", root, ErrInvalidCreateOptions)
+	}
+	sort.Slice(info.Files, func(i, j int) bool {
+		return strings.Join(info.Files[i].Path, "/") < strings.Join(info.Files[j].Path, "/")
+	})
+	return nil
+}
+
+// isHLSOutput сообщает, относится ли файл к результатам конвертации: плейлисту или папке с сегментами
+func isHLSOutput(root, path string, skip map[string]struct{}) bool {
+	for p := path; p != root && p != filepath.Dir(p); p = filepath.Dir(p) {
+		if _, ok := skip[p]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrPathOutsideDir is returned when a path to delete is not inside the torrents directory.
+var ErrPathOutsideDir = errors.New("path is outside of the torrents directory")
+
+// DeleteOptions выбирает, что удалить с диска вместе с торрентом
+type DeleteOptions struct {
+	// Data удаляет загруженные файлы торрента
+	Data bool `json:"data"`
+	// HLS удаляет плейлисты и сегменты, созданные при конвертации
+	HLS bool `json:"hls"`
+	// PieceCompletion сбрасывает сведения о загруженных частях
+	PieceCompletion bool `json:"pieceCompletion"`
+}
+
+// DeleteResult итог удаления торрента
+type DeleteResult struct {
+	FreedBytes   int64 `json:"freedBytes"`
+	RemovedFiles int   `json:"removedFiles"`
+	PiecesReset  int   `json:"piecesReset"`
+}
+
+// deletePlan файлы торрента на диске, собранные до его удаления из клиента
+type deletePlan struct {
+	baseDir string
+	// root папка или файл торрента
+	root string
+	// files загруженные файлы, videos — видеофайлы, для которых могли создаваться HLS
+	files  []string
+	videos []string
+	// hasInfo сообщает, что files взяты из метаданных, а не из содержимого root
+	hasInfo   bool
+	numPieces int
+	// converted торрент конвертировался, profile — сохранённый профиль конвертации
+	converted bool
+	profile   ConversionProfile
+}
+
+// planDeletion collects the on-disk paths of a torrent. It must be called before the torrent is dropped.
+// stored is used when the client has no metadata for the torrent.
+func (c *Client) planDeletion(infoHash string, stored *Torrent) (*deletePlan, error) {
+	hash := metainfo.NewHashFromHex(infoHash)
+	baseDir := c.torrentDir(hash)
+	if stored != nil && stored.SavePath != "" {
+		baseDir = stored.SavePath
+	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	plan := &deletePlan{baseDir: baseDir}
+	if stored.hasConversionOutput() {
+		plan.converted = true
+		plan.profile = stored.ConvertedProfile
+	}
+
+	t, ok := c.tClient.Torrent(hash)
+	if ok && t.Info() != nil {
+		plan.hasInfo = true
+		plan.numPieces = t.NumPieces()
+		plan.root = filepath.Join(baseDir, t.Name())
+		for _, f := range t.Files() {
+			path := filepath.Join(baseDir, f.DisplayPath())
+			if t.Info().IsDir() {
+				path = filepath.Join(baseDir, t.Name(), f.DisplayPath())
+			}
+			plan.files = append(plan.files, path)
+			if filehelpers.IsVideoFile(path) {
+				plan.videos = append(plan.videos, path)
+			}
+		}
+	} else if stored != nil && stored.Name != "" {
+		plan.root = filepath.Join(baseDir, stored.Name)
+		for _, v := range stored.VideoFiles {
+			path, err := filepath.Abs(v.Path)
+			if err != nil {
+				return nil, err
+			}
+			plan.videos = append(plan.videos, path)
+		}
+	}
+
+	if plan.root == "" {
+		return plan, nil
+	}
+	for _, path := range append([]string{plan.root}, append(plan.files, plan.videos...)...) {
+		if err := checkInsideDir(baseDir, path); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// checkInsideDir проверяет, что path лежит внутри base и не совпадает с ней
+func checkInsideDir(base, path string) error {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, ErrPathOutsideDir)
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: %w", path, ErrPathOutsideDir)
+	}
+	return nil
+}
+
+// hlsOutputs возвращает пути, которые создала конвертация видеофайла в HLS, или nil, если плейлиста нет на диске.
+// Одноимённая с видео папка без плейлиста может принадлежать не торренту и результатом конвертации не считается.
+func hlsOutputs(video string, profile ConversionProfile) []string {
+	p, ok := playlistProfile(video, profile)
+	if !ok {
+		return nil
+	}
+	return p.outputs(video)
+}
+
+// execute удаляет выбранное с диска и накапливает итог в result
+func (p *deletePlan) execute(opts DeleteOptions, result *DeleteResult) error {
+	if p.root == "" {
+		return nil
+	}
+
+	var errs []error
+	if opts.HLS {
+		for _, path := range p.hlsPaths() {
+			if err := removePath(path, result); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if opts.Data {
+		files := p.files
+		if !p.hasInfo {
+			// Без метаданных состав торрента неизвестен, удаляется всё содержимое его папки,
+			// кроме результатов конвертации, если их нужно сохранить
+			var err error
+			files, err = p.filesUnderRoot(!opts.HLS)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, path := range files {
+			if err := removePath(path, result); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		pruneEmptyDirs(p.root)
+	}
+
+	return errors.Join(errs...)
+}
+
+// hlsPaths возвращает результаты конвертации видео торрента, которые есть на диске.
+// У торрента, который не конвертировался, их нет, даже если рядом с видео лежат одноимённые папки.
+func (p *deletePlan) hlsPaths() []string {
+	if !p.converted {
+		return nil
+	}
+	var paths []string
+	for _, video := range p.videos {
+		paths = append(paths, hlsOutputs(video, p.profile)...)
+	}
+	return paths
+}
+
+// filesUnderRoot перечисляет файлы внутри root, при keepHLS пропуская результаты конвертации
+func (p *deletePlan) filesUnderRoot(keepHLS bool) ([]string, error) {
+	skip := make(map[string]struct{})
+	if keepHLS {
+		for _, path := range p.hlsPaths() {
+			skip[path] = struct{}{}
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == p.root {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := skip[path]; ok {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// removePath удаляет файл или папку, учитывая освобождённое место. Отсутствующие пути пропускаются.
+func removePath(path string, result *DeleteResult) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	var count int
+	if info.IsDir() {
+		_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+				count++
+			}
+			return nil
+		})
+		err = os.RemoveAll(path)
+	} else {
+		size = info.Size()
+		count = 1
+		err = os.Remove(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	result.FreedBytes += size
+	result.RemovedFiles += count
+	return nil
+}
+
+// pruneEmptyDirs удаляет пустые папки внутри root, начиная с самых глубоких, и сам root, если он опустел
+func pruneEmptyDirs(root string) {
+	var dirs []string
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		// os.Remove не удаляет непустые папки
+		_ = os.Remove(dir)
+	}
+}
+
+// resetPieceCompletion помечает все части торрента незагруженными,
+// чтобы при повторном добавлении данные проверялись заново
+func (c *Client) resetPieceCompletion(infoHash string, numPieces int) (int, error) {
+	hash := metainfo.NewHashFromHex(infoHash)
+	for i := 0; i < numPieces; i++ {
+		if err := c.pieceCompletion.Set(metainfo.PieceKey{InfoHash: hash, Index: i}, false); err != nil {
+			return i, err
+		}
+	}
+	return numPieces, nil
+}
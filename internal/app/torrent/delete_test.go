@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// existingFiles возвращает пути файлов внутри dir относительно неё
+func existingFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+	return files
+}
+
+func TestDeletePlanExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		torrent   string
+		videos    []string
+		hasInfo   bool
+		converted bool
+		profile   ConversionProfile
+		opts      DeleteOptions
+		want      []string
+	}{
+		{
+			name:    "never converted keeps the folder beside the video",
+			files:   []string{"Movie.mkv", "Movie/notes.txt"},
+			torrent: "Movie.mkv",
+			videos:  []string{"Movie.mkv"},
+			hasInfo: true,
+			opts:    DeleteOptions{HLS: true},
+			want:    []string{"Movie.mkv", "Movie/notes.txt"},
+		},
+		{
+			name:      "converted with copy",
+			files:     []string{"Movie.mkv", "Movie.m3u8", "Movie/segment_000.m4s"},
+			torrent:   "Movie.mkv",
+			videos:    []string{"Movie.mkv"},
+			hasInfo:   true,
+			converted: true,
+			profile:   ConversionCopy,
+			opts:      DeleteOptions{HLS: true},
+			want:      []string{"Movie.mkv"},
+		},
+		{
+			name:      "converted before profiles were recorded",
+			files:     []string{"Movie.mkv", "Movie/playlist.m3u8", "Movie/segment_0000.m4s", "Other/notes.txt"},
+			torrent:   "Movie.mkv",
+			videos:    []string{"Movie.mkv"},
+			hasInfo:   true,
+			converted: true,
+			opts:      DeleteOptions{HLS: true},
+			want:      []string{"Movie.mkv", "Other/notes.txt"},
+		},
+		{
+			name:      "folder without the playlist of the recorded profile is kept",
+			files:     []string{"Movie.mkv", "Movie/notes.txt"},
+			torrent:   "Movie.mkv",
+			videos:    []string{"Movie.mkv"},
+			hasInfo:   true,
+			converted: true,
+			profile:   ConversionTranscode,
+			opts:      DeleteOptions{HLS: true},
+			want:      []string{"Movie.mkv", "Movie/notes.txt"},
+		},
+		{
+			name:      "data without metadata keeps the output",
+			files:     []string{"Show/e01.mkv", "Show/e01/playlist.m3u8", "Show/extra.nfo"},
+			torrent:   "Show",
+			videos:    []string{"Show/e01.mkv"},
+			converted: true,
+			profile:   ConversionTranscode,
+			opts:      DeleteOptions{Data: true},
+			want:      []string{"Show/e01/playlist.m3u8"},
+		},
+		{
+			name:    "data without metadata of a never converted torrent removes the whole folder",
+			files:   []string{"Show/e01.mkv", "Show/e01/notes.txt"},
+			torrent: "Show",
+			videos:  []string{"Show/e01.mkv"},
+			opts:    DeleteOptions{Data: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createFiles(t, dir, tt.files...)
+
+			plan := &deletePlan{
+				baseDir:   dir,
+				root:      filepath.Join(dir, tt.torrent),
+				hasInfo:   tt.hasInfo,
+				converted: tt.converted,
+				profile:   tt.profile,
+			}
+			for _, video := range tt.videos {
+				plan.videos = append(plan.videos, filepath.Join(dir, video))
+			}
+			if tt.hasInfo {
+				plan.files = plan.videos
+			}
+
+			var result DeleteResult
+			if err := plan.execute(tt.opts, &result); err != nil {
+				t.Fatalf("execute() error = %v", err)
+			}
+			if got := existingFiles(t, dir); !slices.Equal(got, tt.want) {
+				t.Errorf("files left = %q, want %q", got, tt.want)
+			}
+			if removed := len(tt.files) - len(tt.want); result.RemovedFiles != removed {
+				t.Errorf("RemovedFiles = %d, want %d", result.RemovedFiles, removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package torrent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// pieceScheduleInterval период пересчёта приоритетов частей
+	pieceScheduleInterval = time.Second
+	// sequentialWindowBytes сколько данных впереди загружается с повышенным приоритетом в последовательном режиме
+	sequentialWindowBytes = 32 << 20
+	// minSequentialWindow минимальное окно в частях для торрентов с крупными частями
+	minSequentialWindow = 4
+	// firstLastPercent доля файла в начале и в конце, загружаемая первой
+	firstLastPercent = 1
+)
+
+// DownloadMode порядок загрузки частей торрента
+type DownloadMode struct {
+	// Sequential загружает части по порядку, а не начиная с самых редких
+	Sequential bool `json:"sequential"`
+	// FirstLastPiecesFirst сначала загружает начало и конец каждого файла,
+	// где лежат заголовок и индекс контейнера
+	FirstLastPiecesFirst bool `json:"firstLastPiecesFirst"`
+}
+
+// pieceScheduler повышает приоритет частей торрентов в особых режимах загрузки.
+// Повышенный приоритет ниже, чем у частей, которые читает стриминг.
+type pieceScheduler struct {
+	mu     sync.Mutex
+	modes  map[metainfo.Hash]DownloadMode
+	raised map[metainfo.Hash]map[int]struct{}
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+}
+
+func newPieceScheduler() *pieceScheduler {
+	return &pieceScheduler{
+		modes:    make(map[metainfo.Hash]DownloadMode),
+		raised:   make(map[metainfo.Hash]map[int]struct{}),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// set задаёт режим загрузки торрента, обычный режим снимает повышенные приоритеты
+func (ps *pieceScheduler) set(t *torrent.Torrent, mode DownloadMode) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	hash := t.InfoHash()
+	if mode == (DownloadMode{}) {
+		delete(ps.modes, hash)
+	} else {
+		ps.modes[hash] = mode
+	}
+	ps.schedule(t)
+}
+
+// reset забывает повышенные приоритеты после того, как их сбросил клиент
+func (ps *pieceScheduler) reset(hash metainfo.Hash) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.raised, hash)
+}
+
+// forget удаляет сведения об удалённом из клиента торренте
+func (ps *pieceScheduler) forget(hash metainfo.Hash) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.modes, hash)
+	delete(ps.raised, hash)
+}
+
+// run периодически пересчитывает приоритеты, пока не вызван stop
+func (ps *pieceScheduler) run(cl *torrent.Client) {
+	ticker := time.NewTicker(pieceScheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ps.stopChan:
+			return
+		case <-ticker.C:
+			ps.tick(cl)
+		}
+	}
+}
+
+func (ps *pieceScheduler) tick(cl *torrent.Client) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for hash := range ps.modes {
+		t, ok := cl.Torrent(hash)
+		if !ok {
+			delete(ps.modes, hash)
+			delete(ps.raised, hash)
+			continue
+		}
+		ps.schedule(t)
+	}
+}
+
+// schedule повышает приоритет нужных частей и возвращает обычный остальным. Вызывается под ps.mu.
+func (ps *pieceScheduler) schedule(t *torrent.Torrent) {
+	if t.Info() == nil {
+		return
+	}
+
+	hash := t.InfoHash()
+	wanted := desiredPieces(t, ps.modes[hash])
+	raised := ps.raised[hash]
+
+	for i := range raised {
+		if _, ok := wanted[i]; !ok {
+			// Приоритет файлов и стриминга продолжает действовать, сбрасывается только собственный приоритет части
+			t.Piece(i).SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+	for i := range wanted {
+		if _, ok := raised[i]; !ok {
+			t.Piece(i).SetPriority(torrent.PiecePriorityHigh)
+		}
+	}
+
+	if len(wanted) == 0 {
+		delete(ps.raised, hash)
+	} else {
+		ps.raised[hash] = wanted
+	}
+}
+
+// desiredPieces возвращает незагруженные части выбранных файлов, которым режим повышает приоритет
+func desiredPieces(t *torrent.Torrent, mode DownloadMode) map[int]struct{} {
+	result := make(map[int]struct{})
+	if mode == (DownloadMode{}) {
+		return result
+	}
+
+	complete := make([]bool, 0, t.NumPieces())
+	for _, run := range t.PieceStateRuns() {
+		for i := 0; i < run.Length; i++ {
+			complete = append(complete, run.Complete)
+		}
+	}
+	add := func(i int) bool {
+		if i < 0 || i >= len(complete) || complete[i] {
+			return false
+		}
+		result[i] = struct{}{}
+		return true
+	}
+
+	pieceLength := t.Info().PieceLength
+	files := t.Files()
+
+	if mode.FirstLastPiecesFirst {
+		for _, f := range files {
+			if f.Priority() == torrent.PiecePriorityNone || f.Length() == 0 {
+				continue
+			}
+			span := f.Length() * firstLastPercent / 100
+			count := int((span + pieceLength - 1) / pieceLength)
+			count = max(count, 1)
+			begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+			for i := 0; i < count && begin+i < end; i++ {
+				add(begin + i)
+				add(end - 1 - i)
+			}
+		}
+	}
+
+	if mode.Sequential {
+		window := max(int(sequentialWindowBytes/pieceLength), minSequentialWindow)
+		for _, f := range files {
+			if window == 0 {
+				break
+			}
+			if f.Priority() == torrent.PiecePriorityNone {
+				continue
+			}
+			for i := f.BeginPieceIndex(); i < f.EndPieceIndex() && window > 0; i++ {
+				if _, already := result[i]; already {
+					continue
+				}
+				if add(i) {
+					window--
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+func (ps *pieceScheduler) stop() {
+	ps.closeOnce.Do(func() {
+		close(ps.stopChan)
+	})
+}
+
+// SetDownloadMode sets the piece order of a torrent.
+func (c *Client) SetDownloadMode(infoHash string, mode DownloadMode) error {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return ErrNoMetadata
+	}
+	c.pieces.set(t, mode)
+	return nil
+}
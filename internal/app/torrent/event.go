@@ -38,7 +38,7 @@ func (eh *EventHandler) handleEvent(event Event) {
 		log.Printf("Processing torrent: %s", event.Torrent.Name)
 
 		// Добавляем торрент в клиент
-		if _, err := eh.service.AddTorrent(event.Torrent.Magnet); err != nil {
+		if err := eh.service.RestoreTorrent(event.Torrent); err != nil {
 			log.Printf("Failed to add torrent to client: %v\n", err)
 		} else {
 			log.Printf("Successfully added torrent to client: %s\n", event.Torrent.Name)
@@ -47,6 +47,11 @@ func (eh *EventHandler) handleEvent(event Event) {
 	case "download_completed":
 		log.Printf("Torrent download completed: %s", event.Torrent.Name)
 
+		if event.Torrent.AutoConvert != nil && !*event.Torrent.AutoConvert {
+			log.Printf("Auto conversion is disabled for torrent: %s", event.Torrent.Name)
+			break
+		}
+
 		// Проверяем, не был ли уже обработан
 		if !eh.service.stateManager.IsAlreadyProcessed(event.Torrent.InfoHash) {
 			// Добавляем в очередь на конвертацию
@@ -57,15 +62,36 @@ func (eh *EventHandler) handleEvent(event Event) {
 			log.Printf("Torrent already processed: %s", event.Torrent.Name)
 		}
 
+	case "metadata_received":
+		log.Printf("Torrent metadata received: %s", event.Torrent.Name)
+
+	case "metadata_failed":
+		log.Printf("Torrent metadata fetch failed: %s (%s)", event.Torrent.InfoHash, event.Torrent.Error)
+
 	case "downloading_paused":
 		log.Printf("Torrent downloading paused: %s", event.Torrent.Name)
 
 	case "downloading_resumed":
 		log.Printf("Torrent downloading resumed: %s", event.Torrent.Name)
 
+	case "watch_imported":
+		log.Printf("Torrent imported from watch folder: %s", event.Torrent.InfoHash)
+
+	case "watch_import_failed":
+		log.Printf("Watch folder import failed: %s (%s)", event.Torrent.Name, event.Torrent.Error)
+
+	case "rss_grabbed":
+		log.Printf("Torrent added from RSS feed: %s", event.Torrent.Name)
+
 	case "queued_for_conversion":
 		log.Printf("Torrent queued for conversion: %s", event.Torrent.Name)
 
+	case "recheck_progress":
+		// Ход проверки приходит раз в секунду и не логируется
+
+	case "recheck_completed":
+		log.Printf("Torrent recheck completed: %s", event.Torrent.Name)
+
 	case "conversion_completed":
 		log.Printf("Torrent conversion completed: %s", event.Torrent.Name)
 		// Video file info is updated on demand, so we don't need to do anything here.
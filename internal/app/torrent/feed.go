@@ -0,0 +1,204 @@
+package torrent
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeedItem раздача из RSS или Atom ленты
+type FeedItem struct {
+	Title string `json:"title"`
+	// GUID идентификатор записи, по нему запоминаются уже добавленные раздачи
+	GUID string `json:"guid"`
+	// Source магнет-ссылка или адрес .torrent файла
+	Source string `json:"source"`
+	// Size размер раздачи в байтах, 0 — лента его не указала
+	Size      int64      `json:"size"`
+	Published *time.Time `json:"published,omitempty"`
+}
+
+// feedDocument корневой элемент RSS 2.0 (rss/channel/item) или Atom (feed/entry) ленты
+type feedDocument struct {
+	XMLName xml.Name
+	// Code и Description ошибки Torznab, которую индексатор возвращает корневым элементом <error>
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+	Channel     struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	// Расширения трекеров: size (Jackett), torrent:contentLength, torrent:magnetURI и torznab:attr
+	Size          string     `xml:"size"`
+	ContentLength string     `xml:"contentLength"`
+	MagnetURI     string     `xml:"magnetURI"`
+	Attrs         []feedAttr `xml:"attr"`
+}
+
+type feedAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type atomEntry struct {
+	Title   string `xml:"title"`
+	ID      string `xml:"id"`
+	Updated string `xml:"updated"`
+	Links   []struct {
+		Href   string `xml:"href,attr"`
+		Rel    string `xml:"rel,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"link"`
+}
+
+// decodeFeed читает XML документ ленты
+func decodeFeed(r io.Reader) (*feedDocument, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = feedCharsetReader
+
+	var doc feedDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+	return &doc, nil
+}
+
+// parseFeed разбирает RSS 2.0 или Atom ленту. Записи без ссылки на торрент пропускаются.
+func parseFeed(r io.Reader) ([]FeedItem, error) {
+	doc, err := decodeFeed(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []FeedItem
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, it := range doc.Channel.Items {
+			if item, ok := it.feedItem(); ok {
+				items = append(items, item)
+			}
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			if item, ok := entry.feedItem(); ok {
+				items = append(items, item)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid feed: unexpected root element <%s>", doc.XMLName.Local)
+	}
+	return items, nil
+}
+
+func (it rssItem) feedItem() (FeedItem, bool) {
+	item := FeedItem{
+		Title: strings.TrimSpace(it.Title),
+		GUID:  strings.TrimSpace(it.GUID),
+	}
+
+	attrs := make(map[string]string, len(it.Attrs))
+	for _, a := range it.Attrs {
+		attrs[a.Name] = a.Value
+	}
+
+	// Магнет-ссылка предпочтительнее: для неё не нужно скачивать .torrent файл
+	for _, source := range []string{it.MagnetURI, attrs["magneturl"], it.Enclosure.URL, it.Link} {
+		if source = strings.TrimSpace(source); strings.HasPrefix(source, "magnet:") {
+			item.Source = source
+			break
+		}
+	}
+	if item.Source == "" {
+		item.Source = strings.TrimSpace(it.Enclosure.URL)
+	}
+	if item.Source == "" && isTorrentURL(it.Link) {
+		item.Source = strings.TrimSpace(it.Link)
+	}
+	if item.Source == "" {
+		return FeedItem{}, false
+	}
+
+	for _, size := range []string{it.ContentLength, attrs["size"], it.Size, it.Enclosure.Length} {
+		if n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64); err == nil && n > 0 {
+			item.Size = n
+			break
+		}
+	}
+	item.Published = parseFeedTime(it.PubDate)
+
+	if item.GUID == "" {
+		item.GUID = item.Source
+	}
+	return item, true
+}
+
+func (e atomEntry) feedItem() (FeedItem, bool) {
+	item := FeedItem{
+		Title: strings.TrimSpace(e.Title),
+		GUID:  strings.TrimSpace(e.ID),
+	}
+	for _, link := range e.Links {
+		href := strings.TrimSpace(link.Href)
+		if link.Rel == "enclosure" || strings.HasPrefix(href, "magnet:") || isTorrentURL(href) {
+			item.Source = href
+			if n, err := strconv.ParseInt(link.Length, 10, 64); err == nil && n > 0 {
+				item.Size = n
+			}
+			break
+		}
+	}
+	if item.Source == "" {
+		return FeedItem{}, false
+	}
+	item.Published = parseFeedTime(e.Updated)
+
+	if item.GUID == "" {
+		item.GUID = item.Source
+	}
+	return item, true
+}
+
+// isTorrentURL сообщает, похожа ли ссылка на .torrent файл
+func isTorrentURL(link string) bool {
+	link = strings.ToLower(strings.TrimSpace(link))
+	if i := strings.IndexAny(link, "?#"); i != -1 {
+		link = link[:i]
+	}
+	return strings.HasSuffix(link, ".torrent")
+}
+
+// parseFeedTime разбирает дату в форматах RFC 1123 (RSS) и RFC 3339 (Atom)
+func parseFeedTime(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// feedCharsetReader принимает только UTF-8 и ASCII, перекодировка потребовала бы таблиц кодировок
+func feedCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	}
+	return nil, fmt.Errorf("unsupported feed charset %q", charset)
+}
@@ -0,0 +1,168 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// fetchTimeout ограничивает загрузку лент, результатов поиска и .torrent файлов
+	fetchTimeout = 30 * time.Second
+	// maxFetchRedirects сколько перенаправлений допускается при загрузке
+	maxFetchRedirects = 5
+)
+
+var fetchClient = &http.Client{
+	Timeout: fetchTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxFetchRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			// Индексаторы перенаправляют на магнет-ссылку, её разбирает fetch
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// FetchError is returned when an http(s) source can't be downloaded.
+// Its message names only the host, since feed and indexer URLs often carry access keys.
+type FetchError struct {
+	Host string
+	// StatusCode HTTP статус ответа, 0 — ответа не было
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("failed to fetch from %s: %v", e.Host, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchResult загруженные данные или магнет-ссылка, на которую перенаправил сервер
+type fetchResult struct {
+	data   []byte
+	magnet string
+}
+
+// isHTTPSource сообщает, нужно ли загружать источник по сети
+func isHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetch загружает http(s) ресурс не больше limit байт. cookie передаётся в заголовке Cookie, если задан.
+func fetch(ctx context.Context, rawURL string, limit int64, cookie string) (*fetchResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported source %q", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", createdBy)
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out: %w", err)
+		}
+		return nil, &FetchError{Host: u.Host, Err: err}
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("[torrent] Failed to close response body: %v", err)
+		}
+	}()
+
+	if location := resp.Header.Get("Location"); resp.StatusCode/100 == 3 && strings.HasPrefix(location, "magnet:") {
+		return &fetchResult{magnet: location}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &FetchError{Host: u.Host, StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, &FetchError{Host: u.Host, StatusCode: resp.StatusCode, Err: err}
+	}
+	if int64(len(data)) > limit {
+		return nil, &FetchError{Host: u.Host, StatusCode: resp.StatusCode, Err: fmt.Errorf("response is larger than %d bytes", limit)}
+	}
+	return &fetchResult{data: data}, nil
+}
+
+// fetchURL загружает http(s) ресурс не больше limit байт
+func fetchURL(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	res, err := fetch(ctx, rawURL, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.magnet != "" {
+		return nil, fmt.Errorf("unexpected redirect to a magnet link")
+	}
+	return res.data, nil
+}
+
+// fetchTorrentSource загружает .torrent файл по http(s).
+// Если сервер перенаправляет на магнет-ссылку, вместо метаданных возвращается она.
+func fetchTorrentSource(ctx context.Context, source, cookie string) (*metainfo.MetaInfo, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	res, err := fetch(ctx, source, MaxTorrentFileSize, cookie)
+	if err != nil {
+		return nil, "", err
+	}
+	if res.magnet != "" {
+		return nil, res.magnet, nil
+	}
+
+	// Вместо .torrent файла трекеры часто возвращают страницу входа
+	mi, err := LoadTorrentFile(bytes.NewReader(res.data))
+	if err != nil {
+		u, _ := url.Parse(source)
+		return nil, "", &FetchError{Host: u.Host, StatusCode: http.StatusOK, Err: fmt.Errorf("response is not a .torrent file: %w", err)}
+	}
+	return mi, "", nil
+}
+
+// addFromURL загружает .torrent файл по http(s) и добавляет его.
+// Если сервер перенаправляет на магнет-ссылку, добавляется она.
+func (s *Service) addFromURL(ctx context.Context, source string, opts AddOptions) (string, error) {
+	mi, magnet, err := fetchTorrentSource(ctx, source, opts.Cookie)
+	if err != nil {
+		return "", err
+	}
+	if magnet != "" {
+		return s.AddTorrent(magnet, opts)
+	}
+
+	added, err := s.addTorrentMetaInfo(mi, opts)
+	if err != nil {
+		return "", err
+	}
+	return added.InfoHash, nil
+}
@@ -0,0 +1,353 @@
+package torrent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minLimiterBurst должен вмещать хотя бы один блок протокола (16 КиБ),
+	// иначе anacrolix не сможет отдавать данные при ограниченной скорости
+	minLimiterBurst = 256 << 10
+	// throttleInterval период пересчёта ограничений отдельных торрентов
+	throttleInterval = 250 * time.Millisecond
+)
+
+// newRateLimiter создаёт ограничитель скорости, 0 — без ограничения
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	l := rate.NewLimiter(rate.Inf, 0)
+	setRateLimit(l, bytesPerSecond)
+	return l
+}
+
+// setRateLimit меняет ограничение у уже используемого клиентом ограничителя
+func setRateLimit(l *rate.Limiter, bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		l.SetLimit(rate.Inf)
+		return
+	}
+	burst := bytesPerSecond
+	if burst < minLimiterBurst {
+		burst = minLimiterBurst
+	}
+	l.SetBurst(int(burst))
+	l.SetLimit(rate.Limit(bytesPerSecond))
+}
+
+func limiterValue(l *rate.Limiter) int64 {
+	if l.Limit() == rate.Inf {
+		return 0
+	}
+	return int64(l.Limit())
+}
+
+// minLimit возвращает меньшее из ограничений, где 0 означает отсутствие ограничения
+func minLimit(a, b int64) int64 {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	case a < b:
+		return a
+	default:
+		return b
+	}
+}
+
+// torrentThrottle состояние ограничения скорости одного торрента.
+// anacrolix не умеет ограничивать отдельные торренты, поэтому обмен данными
+// разрешается и запрещается по принципу token bucket.
+type torrentThrottle struct {
+	limits RateLimits
+
+	lastRead    int64
+	lastWritten int64
+	lastTick    time.Time
+
+	downloadTokens float64
+	uploadTokens   float64
+
+	downloadBlocked bool
+	uploadBlocked   bool
+}
+
+// holdReason причина, по которой торренту запрещён обмен данными помимо ограничения скорости
+type holdReason uint8
+
+const (
+	holdPaused holdReason = 1 << iota
+	holdQueued
+	// holdMoving останавливает только загрузку, пока данные переносятся в другую папку
+	holdMoving
+)
+
+// uploadHolds причины, которые запрещают и отдачу
+const uploadHolds = holdPaused | holdQueued
+
+// throttler применяет ограничения скорости отдельных торрентов.
+// Он же хранит приостановленные и ожидающие в очереди торренты, чтобы не разрешать им обмен данными.
+type throttler struct {
+	mu        sync.Mutex
+	torrents  map[metainfo.Hash]*torrentThrottle
+	holds     map[metainfo.Hash]holdReason
+	stopChan  chan struct{}
+	closeOnce sync.Once
+}
+
+func newThrottler() *throttler {
+	return &throttler{
+		torrents: make(map[metainfo.Hash]*torrentThrottle),
+		holds:    make(map[metainfo.Hash]holdReason),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// hold запрещает торренту обмен данными до снятия всех причин через unhold
+func (th *throttler) hold(t *torrent.Torrent, reason holdReason) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	hash := t.InfoHash()
+	th.holds[hash] |= reason
+	t.DisallowDataDownload()
+	if reason&uploadHolds != 0 {
+		t.DisallowDataUpload()
+	}
+}
+
+// unhold снимает причину запрета, сохраняя запреты ограничителя скорости и остальные причины
+func (th *throttler) unhold(t *torrent.Torrent, reason holdReason) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	hash := t.InfoHash()
+	if th.holds[hash]&reason == 0 {
+		return
+	}
+	th.holds[hash] &^= reason
+	remaining := th.holds[hash]
+	if remaining == 0 {
+		delete(th.holds, hash)
+	}
+
+	tt, throttled := th.torrents[hash]
+	if remaining == 0 && (!throttled || !tt.downloadBlocked) {
+		t.AllowDataDownload()
+	}
+	if remaining&uploadHolds == 0 && (!throttled || !tt.uploadBlocked) {
+		t.AllowDataUpload()
+	}
+}
+
+// held возвращает причины запрета обмена данными торрента
+func (th *throttler) held(hash metainfo.Hash) holdReason {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	return th.holds[hash]
+}
+
+// forget удаляет сведения об удалённом из клиента торренте
+func (th *throttler) forget(hash metainfo.Hash) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	delete(th.torrents, hash)
+	delete(th.holds, hash)
+}
+
+// allowDownload разрешает загрузку, если торрент не удерживается. Вызывается под th.mu.
+func (th *throttler) allowDownload(t *torrent.Torrent) {
+	if th.holds[t.InfoHash()] == 0 {
+		t.AllowDataDownload()
+	}
+}
+
+// allowUpload разрешает отдачу, если торрент не удерживается. Вызывается под th.mu.
+func (th *throttler) allowUpload(t *torrent.Torrent) {
+	if th.holds[t.InfoHash()]&uploadHolds == 0 {
+		t.AllowDataUpload()
+	}
+}
+
+// set задаёт ограничения торрента, нулевые ограничения снимают их
+func (th *throttler) set(t *torrent.Torrent, limits RateLimits) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	hash := t.InfoHash()
+	current, exists := th.torrents[hash]
+
+	if limits == (RateLimits{}) {
+		if exists {
+			th.release(t, current)
+			delete(th.torrents, hash)
+		}
+		return
+	}
+
+	if !exists {
+		stats := t.Stats()
+		current = &torrentThrottle{
+			lastRead:    stats.BytesReadUsefulData.Int64(),
+			lastWritten: stats.BytesWrittenData.Int64(),
+			lastTick:    time.Now(),
+		}
+		th.torrents[hash] = current
+	}
+	current.limits = limits
+	if limits.Download <= 0 && current.downloadBlocked {
+		th.allowDownload(t)
+		current.downloadBlocked = false
+	}
+	if limits.Upload <= 0 && current.uploadBlocked {
+		th.allowUpload(t)
+		current.uploadBlocked = false
+	}
+}
+
+// get возвращает ограничения торрента
+func (th *throttler) get(hash metainfo.Hash) RateLimits {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	if current, ok := th.torrents[hash]; ok {
+		return current.limits
+	}
+	return RateLimits{}
+}
+
+// release снимает запреты, выставленные ограничителем
+func (th *throttler) release(t *torrent.Torrent, tt *torrentThrottle) {
+	if tt.downloadBlocked {
+		th.allowDownload(t)
+	}
+	if tt.uploadBlocked {
+		th.allowUpload(t)
+	}
+}
+
+// run периодически пересчитывает ограничения, пока не вызван stop
+func (th *throttler) run(cl *torrent.Client) {
+	ticker := time.NewTicker(throttleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-th.stopChan:
+			return
+		case now := <-ticker.C:
+			th.tick(cl, now)
+		}
+	}
+}
+
+func (th *throttler) tick(cl *torrent.Client, now time.Time) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	for hash, tt := range th.torrents {
+		t, ok := cl.Torrent(hash)
+		if !ok {
+			delete(th.torrents, hash)
+			continue
+		}
+
+		stats := t.Stats()
+		read := stats.BytesReadUsefulData.Int64()
+		written := stats.BytesWrittenData.Int64()
+		elapsed := now.Sub(tt.lastTick).Seconds()
+
+		if tt.limits.Download > 0 {
+			var blocked bool
+			tt.downloadTokens, blocked = spend(tt.downloadTokens, tt.limits.Download, elapsed, read-tt.lastRead)
+			if blocked != tt.downloadBlocked {
+				if blocked {
+					t.DisallowDataDownload()
+				} else {
+					th.allowDownload(t)
+				}
+				tt.downloadBlocked = blocked
+			}
+		}
+
+		if tt.limits.Upload > 0 {
+			var blocked bool
+			tt.uploadTokens, blocked = spend(tt.uploadTokens, tt.limits.Upload, elapsed, written-tt.lastWritten)
+			if blocked != tt.uploadBlocked {
+				if blocked {
+					t.DisallowDataUpload()
+				} else {
+					th.allowUpload(t)
+				}
+				tt.uploadBlocked = blocked
+			}
+		}
+
+		tt.lastRead = read
+		tt.lastWritten = written
+		tt.lastTick = now
+	}
+}
+
+// refill пополняет запас байт, не накапливая больше секунды трафика
+func refill(tokens float64, limit int64, elapsed float64) float64 {
+	tokens += float64(limit) * elapsed
+	if tokens > float64(limit) {
+		tokens = float64(limit)
+	}
+	return tokens
+}
+
+// spend пополняет запас за elapsed секунд, списывает переданные байты и сообщает,
+// нужно ли запретить обмен. Перерасход переносится на следующие интервалы.
+func spend(tokens float64, limit int64, elapsed float64, used int64) (float64, bool) {
+	tokens = refill(tokens, limit, elapsed) - float64(used)
+	return tokens, tokens <= 0
+}
+
+func (th *throttler) stop() {
+	th.closeOnce.Do(func() {
+		close(th.stopChan)
+	})
+}
+
+// GlobalLimits returns the client-wide rate limits.
+func (c *Client) GlobalLimits() RateLimits {
+	return RateLimits{
+		Download: limiterValue(c.downloadLimiter),
+		Upload:   limiterValue(c.uploadLimiter),
+	}
+}
+
+// SetGlobalLimits changes the client-wide rate limits at runtime.
+func (c *Client) SetGlobalLimits(limits RateLimits) {
+	setRateLimit(c.downloadLimiter, limits.Download)
+	setRateLimit(c.uploadLimiter, limits.Upload)
+}
+
+// SetTorrentLimits sets the rate limits of a single torrent, zero limits remove them.
+func (c *Client) SetTorrentLimits(infoHash string, limits RateLimits) error {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	c.throttle.set(t, limits)
+	return nil
+}
+
+// effectiveLimits combines the torrent limits with the global ones.
+func (c *Client) effectiveLimits(hash metainfo.Hash) RateLimits {
+	global := c.GlobalLimits()
+	own := c.throttle.get(hash)
+	return RateLimits{
+		Download: minLimit(global.Download, own.Download),
+		Upload:   minLimit(global.Upload, own.Upload),
+	}
+}
@@ -0,0 +1,133 @@
+package torrent
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  float64
+		limit   int64
+		elapsed float64
+		want    float64
+	}{
+		{name: "adds limit per second", tokens: 0, limit: 1000, elapsed: 0.25, want: 250},
+		{name: "keeps at most one second", tokens: 900, limit: 1000, elapsed: 0.25, want: 1000},
+		{name: "long pause is capped", tokens: 0, limit: 1000, elapsed: 60, want: 1000},
+		{name: "pays off debt first", tokens: -500, limit: 1000, elapsed: 0.25, want: -250},
+		{name: "no time passed", tokens: 100, limit: 1000, elapsed: 0, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refill(tt.tokens, tt.limit, tt.elapsed); got != tt.want {
+				t.Errorf("refill(%v, %d, %v) = %v, want %v", tt.tokens, tt.limit, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpendBlocksUntilDebtIsRepaid(t *testing.T) {
+	const limit = 1000
+	// Каждый шаг — один тик throttleInterval и байты, переданные за него
+	steps := []struct {
+		used        int64
+		wantTokens  float64
+		wantBlocked bool
+	}{
+		{used: 100, wantTokens: 150, wantBlocked: false},
+		{used: 1000, wantTokens: -600, wantBlocked: true},
+		{used: 0, wantTokens: -350, wantBlocked: true},
+		{used: 0, wantTokens: -100, wantBlocked: true},
+		{used: 0, wantTokens: 150, wantBlocked: false},
+		{used: 400, wantTokens: 0, wantBlocked: true},
+	}
+
+	tokens := 0.0
+	elapsed := throttleInterval.Seconds()
+	for i, step := range steps {
+		var blocked bool
+		tokens, blocked = spend(tokens, limit, elapsed, step.used)
+		if tokens != step.wantTokens || blocked != step.wantBlocked {
+			t.Fatalf("step %d: spend() = %v, %v, want %v, %v", i, tokens, blocked, step.wantTokens, step.wantBlocked)
+		}
+	}
+}
+
+func TestSpendAveragesToLimit(t *testing.T) {
+	const limit = 64 << 10
+	elapsed := throttleInterval.Seconds()
+
+	// Торрент передаёт данные, пока ему разрешено, по 4 блока за тик
+	tokens := 0.0
+	var total int64
+	blocked := false
+	ticks := 400
+	for range ticks {
+		var used int64
+		if !blocked {
+			used = 64 << 10
+		}
+		total += used
+		tokens, blocked = spend(tokens, limit, elapsed, used)
+	}
+
+	seconds := float64(ticks) * elapsed
+	avg := float64(total) / seconds
+	if math.Abs(avg-limit)/limit > 0.05 {
+		t.Errorf("average rate %.0f B/s, want about %d B/s", avg, limit)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int64
+		wantLimit rate.Limit
+		wantBurst int
+	}{
+		{name: "zero removes the limit", limit: 0, wantLimit: rate.Inf},
+		{name: "negative removes the limit", limit: -1, wantLimit: rate.Inf},
+		{name: "small limit keeps the minimal burst", limit: 1000, wantLimit: 1000, wantBurst: minLimiterBurst},
+		{name: "large limit bursts one second", limit: 10 << 20, wantLimit: 10 << 20, wantBurst: 10 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(0)
+			setRateLimit(l, tt.limit)
+			if l.Limit() != tt.wantLimit {
+				t.Errorf("limit = %v, want %v", l.Limit(), tt.wantLimit)
+			}
+			if tt.wantLimit != rate.Inf && l.Burst() != tt.wantBurst {
+				t.Errorf("burst = %d, want %d", l.Burst(), tt.wantBurst)
+			}
+			if got, want := limiterValue(l), max(tt.limit, 0); got != want {
+				t.Errorf("limiterValue() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMinLimit(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{0, 0, 0},
+		{0, 100, 100},
+		{100, 0, 100},
+		{100, 200, 100},
+		{300, 200, 200},
+		{-1, 50, 50},
+	}
+
+	for _, tt := range tests {
+		if got := minLimit(tt.a, tt.b); got != tt.want {
+			t.Errorf("minLimit(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
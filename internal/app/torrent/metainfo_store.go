@@ -0,0 +1,86 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// metainfoDirName папка рядом с файлом состояния, в которой хранятся .torrent файлы
+const metainfoDirName = "metainfo"
+
+// metainfoPath возвращает путь к сохранённому .torrent файлу торрента
+func (sm *StateManager) metainfoPath(infoHash string) string {
+	return filepath.Join(sm.metainfoDir, infoHash+".torrent")
+}
+
+// SaveMetaInfo сохраняет метаданные торрента, чтобы после перезапуска не ждать их от пиров.
+// Уже сохранённый файл не перезаписывается.
+func (sm *StateManager) SaveMetaInfo(infoHash string, mi *metainfo.MetaInfo) error {
+	path := sm.metainfoPath(infoHash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(sm.metainfoDir, 0o755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл, чтобы при сбое не остался обрезанный .torrent
+	tmp, err := os.CreateTemp(sm.metainfoDir, infoHash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := mi.Write(tmp); err != nil {
+		filehelpers.CloseFile(tmp)
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write metainfo: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadMetaInfo читает сохранённые метаданные торрента, fs.ErrNotExist означает, что их нет
+func (sm *StateManager) LoadMetaInfo(infoHash string) (*metainfo.MetaInfo, error) {
+	return metainfo.LoadFromFile(sm.metainfoPath(infoHash))
+}
+
+// removeMetaInfo удаляет сохранённые метаданные торрента
+func (sm *StateManager) removeMetaInfo(infoHash string) error {
+	err := os.Remove(sm.metainfoPath(infoHash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// torrentMetaInfo возвращает метаданные торрента, пригодные для повторного добавления в клиент
+func torrentMetaInfo(t *torrent.Torrent) metainfo.MetaInfo {
+	mi := t.Metainfo()
+	if !t.Info().HasV2() {
+		// anacrolix отдаёт пустые слои частей и для торрентов v1, а при добавлении требует для них корни файлов
+		mi.PieceLayers = nil
+	}
+	return mi
+}
+
+// MetaInfo returns the metainfo of a torrent with known metadata.
+func (c *Client) MetaInfo(infoHash string) (*metainfo.MetaInfo, error) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+	mi := torrentMetaInfo(t)
+	return &mi, nil
+}
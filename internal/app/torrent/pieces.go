@@ -0,0 +1,189 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// PieceStatus состояние части торрента
+type PieceStatus string
+
+const (
+	PieceComplete PieceStatus = "complete"
+	// PieceDownloading часть загружена не полностью
+	PieceDownloading PieceStatus = "downloading"
+	// PieceChecking часть проверяется или ждёт проверки хеша
+	PieceChecking PieceStatus = "checking"
+	PieceMissing  PieceStatus = "missing"
+	// PieceSkipped часть относится только к пропущенным файлам и не загружается
+	PieceSkipped PieceStatus = "skipped"
+)
+
+// PieceRun несколько подряд идущих частей с одинаковым состоянием
+type PieceRun struct {
+	Status PieceStatus `json:"status"`
+	Length int         `json:"length"`
+}
+
+// AvailabilityRun несколько подряд идущих частей, которые есть у одинакового числа пиров
+type AvailabilityRun struct {
+	Peers  int `json:"peers"`
+	Length int `json:"length"`
+}
+
+// PieceMap карта частей торрента, закодированная длинами серий
+type PieceMap struct {
+	InfoHash    string `json:"infoHash"`
+	NumPieces   int    `json:"numPieces"`
+	PieceLength int64  `json:"pieceLength"`
+	// Peers подключённые пиры, по которым посчитана доступность
+	Peers        int               `json:"peers"`
+	Pieces       []PieceRun        `json:"pieces"`
+	Availability []AvailabilityRun `json:"availability"`
+}
+
+// PieceChange новое состояние одной части
+type PieceChange struct {
+	Index  int         `json:"index"`
+	Status PieceStatus `json:"status"`
+}
+
+// pieceStatus сводит состояние части anacrolix к одному значению
+func pieceStatus(ps torrent.PieceState) PieceStatus {
+	switch {
+	case ps.Hashing || ps.QueuedForHash || ps.Checking || ps.Marking:
+		// При перепроверке загруженная часть тоже показывается как проверяемая
+		return PieceChecking
+	case ps.Complete && ps.Ok:
+		return PieceComplete
+	case ps.Partial:
+		return PieceDownloading
+	case ps.Priority == torrent.PiecePriorityNone:
+		return PieceSkipped
+	default:
+		return PieceMissing
+	}
+}
+
+// pieceRuns переводит серии состояний anacrolix в серии PieceStatus, объединяя соседние серии с одинаковым значением
+func pieceRuns(runs torrent.PieceStateRuns) []PieceRun {
+	result := make([]PieceRun, 0, len(runs))
+	for _, run := range runs {
+		status := pieceStatus(run.PieceState)
+		if n := len(result); n > 0 && result[n-1].Status == status {
+			result[n-1].Length += run.Length
+			continue
+		}
+		result = append(result, PieceRun{Status: status, Length: run.Length})
+	}
+	return result
+}
+
+// availabilityRuns считает, у скольких подключённых пиров есть каждая часть
+func availabilityRuns(t *torrent.Torrent) ([]AvailabilityRun, int) {
+	numPieces := t.NumPieces()
+	counts := make([]int, numPieces)
+	conns := t.PeerConns()
+	for _, pc := range conns {
+		// Пир с HaveAll до получения метаданных может заявить больше частей, чем есть в торренте
+		pc.PeerPieces().Iterate(func(i uint32) bool {
+			if int(i) >= numPieces {
+				return false
+			}
+			counts[i]++
+			return true
+		})
+	}
+
+	var runs []AvailabilityRun
+	for _, count := range counts {
+		if n := len(runs); n > 0 && runs[n-1].Peers == count {
+			runs[n-1].Length++
+			continue
+		}
+		runs = append(runs, AvailabilityRun{Peers: count, Length: 1})
+	}
+	return runs, len(conns)
+}
+
+// PieceMap returns the state of every piece of a torrent and how many connected peers have it.
+func (c *Client) PieceMap(infoHash string) (PieceMap, error) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return PieceMap{}, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return PieceMap{}, ErrNoMetadata
+	}
+	return buildPieceMap(t, pieceRuns(t.PieceStateRuns())), nil
+}
+
+// buildPieceMap собирает карту частей из снимка их состояний
+func buildPieceMap(t *torrent.Torrent, pieces []PieceRun) PieceMap {
+	availability, peers := availabilityRuns(t)
+	return PieceMap{
+		InfoHash:     t.InfoHash().HexString(),
+		NumPieces:    t.NumPieces(),
+		PieceLength:  t.Info().PieceLength,
+		Peers:        peers,
+		Pieces:       pieces,
+		Availability: availability,
+	}
+}
+
+// WatchPieces returns the piece map of a torrent and streams piece state changes after it
+// until ctx is done or the torrent is dropped.
+func (c *Client) WatchPieces(ctx context.Context, infoHash string) (PieceMap, <-chan PieceChange, error) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return PieceMap{}, nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return PieceMap{}, nil, ErrNoMetadata
+	}
+
+	// Подписка оформляется до снимка, чтобы между ними не потерялось ни одно изменение
+	sub := t.SubscribePieceStateChanges()
+	runs := pieceRuns(t.PieceStateRuns())
+	// anacrolix сообщает и о смене внутренних флагов, отправляются только изменения PieceStatus
+	last := make([]PieceStatus, 0, t.NumPieces())
+	for _, run := range runs {
+		for range run.Length {
+			last = append(last, run.Status)
+		}
+	}
+	changes := make(chan PieceChange)
+	go func() {
+		defer close(changes)
+		defer sub.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.Closed():
+				return
+			case v, ok := <-sub.Values:
+				if !ok {
+					return
+				}
+				status := pieceStatus(v.PieceState)
+				if v.Index < len(last) {
+					if last[v.Index] == status {
+						continue
+					}
+					last[v.Index] = status
+				}
+				select {
+				case changes <- PieceChange{Index: v.Index, Status: status}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return buildPieceMap(t, runs), changes, nil
+}
@@ -0,0 +1,461 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const (
+	// previewTTL сколько хранится предпросмотр, который не подтвердили и не запрашивали
+	previewTTL = 15 * time.Minute
+	// previewCleanupInterval как часто удаляются устаревшие предпросмотры
+	previewCleanupInterval = time.Minute
+)
+
+var (
+	// ErrPreviewNotFound is returned for an unknown or expired preview.
+	ErrPreviewNotFound = errors.New("torrent preview not found")
+	// ErrPreviewNotReady is returned when a preview is confirmed before its metadata is resolved.
+	ErrPreviewNotReady = errors.New("torrent preview metadata is not resolved yet")
+	// ErrTorrentExists is returned when a preview is confirmed for a torrent that is already added.
+	ErrTorrentExists = errors.New("torrent is already added")
+)
+
+// PreviewFile файл или папка в дереве файлов предпросмотра
+type PreviewFile struct {
+	Name string `json:"name"`
+	// Path путь файла внутри торрента, по нему выбираются файлы при подтверждении
+	Path     string        `json:"path"`
+	IsDir    bool          `json:"isDir"`
+	Size     int64         `json:"size"`
+	IsVideo  bool          `json:"isVideo,omitempty"`
+	Children []PreviewFile `json:"children,omitempty"`
+}
+
+// TorrentPreview метаданные торрента, который ещё не добавлен
+type TorrentPreview struct {
+	InfoHash string `json:"infoHash"`
+	Name     string `json:"name"`
+	// Ready метаданные получены, предпросмотр можно подтвердить
+	Ready bool `json:"ready"`
+	// Error причина, по которой метаданные не удалось получить
+	Error       string        `json:"error,omitempty"`
+	TotalSize   int64         `json:"totalSize"`
+	PieceLength int64         `json:"pieceLength"`
+	NumPieces   int           `json:"numPieces"`
+	Private     bool          `json:"private"`
+	Trackers    []string      `json:"trackers"`
+	Files       []PreviewFile `json:"files"`
+	// Exists торрент уже добавлен
+	Exists    bool      `json:"exists"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// torrentPreview предпросмотр и метаданные, с которыми торрент будет добавлен
+type torrentPreview struct {
+	TorrentPreview
+	mi     *metainfo.MetaInfo
+	cancel context.CancelFunc
+	// done закрывается, когда получение метаданных завершилось
+	done chan struct{}
+}
+
+// previewStorage хранилище торрентов, для которых нужны только метаданные: данные не читаются и не пишутся
+type previewStorage struct{}
+
+func (previewStorage) OpenTorrent(context.Context, *metainfo.Info, metainfo.Hash) (storage.TorrentImpl, error) {
+	return storage.TorrentImpl{
+		Piece: func(metainfo.Piece) storage.PieceImpl { return previewPiece{} },
+		Close: func() error { return nil },
+	}, nil
+}
+
+type previewPiece struct{}
+
+func (previewPiece) ReadAt([]byte, int64) (int, error) { return 0, io.EOF }
+
+func (previewPiece) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New("preview torrents do not store data")
+}
+
+func (previewPiece) MarkComplete() error { return errors.New("preview torrents do not store data") }
+
+func (previewPiece) MarkNotComplete() error { return nil }
+
+func (previewPiece) Completion() storage.Completion { return storage.Completion{Ok: true} }
+
+// FetchMetaInfo resolves the metadata of a magnet link without downloading any data.
+// A torrent the client doesn't have yet is added in metadata-only mode and dropped once
+// the metadata arrives or ctx is done.
+func (c *Client) FetchMetaInfo(ctx context.Context, magnet string) (*metainfo.MetaInfo, error) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnet)
+	if err != nil {
+		return nil, err
+	}
+	spec.Storage = previewStorage{}
+	spec.DisallowDataDownload = true
+	spec.DisallowDataUpload = true
+
+	c.previewMu.Lock()
+	t, isNew, err := c.tClient.AddTorrentSpec(spec)
+	if err == nil && isNew {
+		c.previews[t.InfoHash()] = struct{}{}
+	}
+	c.previewMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if isNew {
+		defer c.dropPreview(t.InfoHash())
+		c.addExtraTrackers(t)
+		c.trackers.sync()
+	}
+
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.Closed():
+		return nil, errors.New("torrent was dropped before metadata arrived")
+	}
+	mi := torrentMetaInfo(t)
+	return &mi, nil
+}
+
+// isPreview сообщает, добавлен ли торрент только ради метаданных
+func (c *Client) isPreview(hash metainfo.Hash) bool {
+	c.previewMu.Lock()
+	defer c.previewMu.Unlock()
+	_, ok := c.previews[hash]
+	return ok
+}
+
+// dropPreview удаляет из клиента торрент, добавленный только ради метаданных.
+// Вызывается и перед настоящим добавлением: иначе клиент вернул бы торрент без хранилища.
+func (c *Client) dropPreview(hash metainfo.Hash) {
+	c.previewMu.Lock()
+	_, ok := c.previews[hash]
+	delete(c.previews, hash)
+	c.previewMu.Unlock()
+
+	if ok {
+		if err := c.DeleteTorrent(hash.HexString()); err != nil {
+			log.Printf("[torrent] Failed to drop preview of %s: %v", hash.HexString(), err)
+		}
+	}
+}
+
+// PreviewTorrent starts resolving the metadata of a magnet link or http(s) .torrent URL without adding the torrent.
+// A .torrent file is ready at once, a magnet link is resolved in the background (see WaitForPreview).
+func (s *Service) PreviewTorrent(ctx context.Context, source, cookie string) (*TorrentPreview, error) {
+	if isHTTPSource(source) {
+		mi, magnet, err := fetchTorrentSource(ctx, source, cookie)
+		if err != nil {
+			return nil, err
+		}
+		if mi != nil {
+			return s.addPreview(mi)
+		}
+		source = magnet
+	}
+	if !strings.HasPrefix(source, "magnet:") {
+		return nil, fmt.Errorf("unsupported source: only magnet links and http(s) .torrent URLs can be previewed")
+	}
+
+	magnet, err := metainfo.ParseMagnetUri(source)
+	if err != nil {
+		return nil, err
+	}
+	infoHash := magnet.InfoHash.HexString()
+
+	s.previewMu.Lock()
+	// Предпросмотр, метаданные которого не удалось получить, запускается заново
+	if p, ok := s.previews[infoHash]; ok && p.Error == "" {
+		p.ExpiresAt = time.Now().Add(previewTTL)
+		s.previewMu.Unlock()
+		return s.previewSnapshot(p), nil
+	}
+	// Метаданные получаются в фоне и переживают запрос, поэтому его контекст здесь не используется
+	var resolveCtx context.Context
+	var cancel context.CancelFunc
+	if s.metadataTimeout > 0 {
+		resolveCtx, cancel = context.WithTimeout(context.Background(), s.metadataTimeout)
+	} else {
+		resolveCtx, cancel = context.WithCancel(context.Background())
+	}
+	p := &torrentPreview{
+		TorrentPreview: TorrentPreview{
+			InfoHash:  infoHash,
+			Name:      magnet.DisplayName,
+			Trackers:  append([]string{}, magnet.Trackers...),
+			Files:     []PreviewFile{},
+			ExpiresAt: time.Now().Add(previewTTL),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.previews[infoHash] = p
+	s.previewMu.Unlock()
+
+	log.Printf("[service] Resolving metadata of %s for preview", infoHash)
+	go s.resolvePreview(resolveCtx, p, source)
+
+	return s.previewSnapshot(p), nil
+}
+
+// PreviewTorrentFile previews the contents of a .torrent file.
+func (s *Service) PreviewTorrentFile(r io.Reader) (*TorrentPreview, error) {
+	mi, err := LoadTorrentFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.addPreview(mi)
+}
+
+// addPreview сохраняет предпросмотр торрента с уже известными метаданными
+func (s *Service) addPreview(mi *metainfo.MetaInfo) (*TorrentPreview, error) {
+	p := &torrentPreview{
+		TorrentPreview: TorrentPreview{
+			InfoHash:  mi.HashInfoBytes().HexString(),
+			ExpiresAt: time.Now().Add(previewTTL),
+		},
+		cancel: func() {},
+		done:   make(chan struct{}),
+	}
+	if err := p.setMetaInfo(mi); err != nil {
+		return nil, err
+	}
+	close(p.done)
+
+	s.previewMu.Lock()
+	if old, ok := s.previews[p.InfoHash]; ok {
+		old.cancel()
+	}
+	s.previews[p.InfoHash] = p
+	s.previewMu.Unlock()
+
+	return s.previewSnapshot(p), nil
+}
+
+// resolvePreview получает метаданные магнет-ссылки для предпросмотра
+func (s *Service) resolvePreview(ctx context.Context, p *torrentPreview, magnet string) {
+	defer p.cancel()
+	defer close(p.done)
+
+	mi, err := s.client.FetchMetaInfo(ctx, magnet)
+	if err == nil {
+		s.previewMu.Lock()
+		err = p.setMetaInfo(mi)
+		s.previewMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("[service] Failed to resolve metadata of %s for preview: %v", p.InfoHash, err)
+		s.previewMu.Lock()
+		p.Error = err.Error()
+		s.previewMu.Unlock()
+		return
+	}
+	log.Printf("[service] Metadata of %s (%s) resolved for preview", p.Name, p.InfoHash)
+}
+
+// setMetaInfo заполняет предпросмотр по метаданным торрента
+func (p *torrentPreview) setMetaInfo(mi *metainfo.MetaInfo) error {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+	if err := validateInfo(&info); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+
+	trackers := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, u := range tier {
+			if _, ok := seen[u]; !ok {
+				seen[u] = struct{}{}
+				trackers = append(trackers, u)
+			}
+		}
+	}
+	// Трекеры из магнет-ссылки остаются, если в метаданных их нет
+	if len(trackers) > 0 || len(p.Trackers) == 0 {
+		p.Trackers = trackers
+	}
+
+	p.mi = mi
+	p.Name = info.BestName()
+	p.TotalSize = info.TotalLength()
+	p.PieceLength = info.PieceLength
+	p.NumPieces = info.NumPieces()
+	p.Private = info.Private != nil && *info.Private
+	p.Files = previewFileTree(&info)
+	p.Ready = true
+	return nil
+}
+
+// previewFileTree строит дерево файлов торрента. Пути совпадают с путями файлов после добавления.
+func previewFileTree(info *metainfo.Info) []PreviewFile {
+	if !info.IsDir() {
+		return []PreviewFile{{
+			Name:    info.BestName(),
+			Path:    info.BestName(),
+			Size:    info.TotalLength(),
+			IsVideo: filehelpers.IsVideoFile(info.BestName()),
+		}}
+	}
+
+	root := &PreviewFile{IsDir: true}
+	for _, fi := range info.UpvertedFiles() {
+		parts := fi.BestPath()
+		node := root
+		for i, part := range parts {
+			node.Size += fi.Length
+			if i == len(parts)-1 {
+				path := strings.Join(parts, "/")
+				node.Children = append(node.Children, PreviewFile{
+					Name:    part,
+					Path:    path,
+					Size:    fi.Length,
+					IsVideo: filehelpers.IsVideoFile(path),
+				})
+				break
+			}
+			node = previewDir(node, part, strings.Join(parts[:i+1], "/"))
+		}
+	}
+	return root.Children
+}
+
+// previewDir возвращает дочернюю папку узла, создавая её при необходимости
+func previewDir(node *PreviewFile, name, path string) *PreviewFile {
+	for i := range node.Children {
+		if child := &node.Children[i]; child.IsDir && child.Name == name {
+			return child
+		}
+	}
+	node.Children = append(node.Children, PreviewFile{Name: name, Path: path, IsDir: true})
+	return &node.Children[len(node.Children)-1]
+}
+
+// previewSnapshot копирует предпросмотр для ответа API
+func (s *Service) previewSnapshot(p *torrentPreview) *TorrentPreview {
+	s.previewMu.Lock()
+	snapshot := p.TorrentPreview
+	s.previewMu.Unlock()
+
+	_, err := s.stateManager.GetTorrent(snapshot.InfoHash)
+	snapshot.Exists = err == nil
+	return &snapshot
+}
+
+// GetPreview returns a preview and keeps it from expiring.
+func (s *Service) GetPreview(infoHash string) (*TorrentPreview, error) {
+	s.previewMu.Lock()
+	p, ok := s.previews[infoHash]
+	if ok {
+		p.ExpiresAt = time.Now().Add(previewTTL)
+	}
+	s.previewMu.Unlock()
+	if !ok {
+		return nil, ErrPreviewNotFound
+	}
+	return s.previewSnapshot(p), nil
+}
+
+// WaitForPreview blocks until the metadata of a preview is resolved or fails, or ctx is done.
+// It returns the preview in its current state either way.
+func (s *Service) WaitForPreview(ctx context.Context, infoHash string) (*TorrentPreview, error) {
+	s.previewMu.Lock()
+	p, ok := s.previews[infoHash]
+	s.previewMu.Unlock()
+	if !ok {
+		return nil, ErrPreviewNotFound
+	}
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+	}
+	return s.GetPreview(infoHash)
+}
+
+// ConfirmPreview adds a previewed torrent with the given options and starts its download.
+func (s *Service) ConfirmPreview(infoHash string, opts AddOptions) (*AddedTorrent, error) {
+	s.previewMu.Lock()
+	p, ok := s.previews[infoHash]
+	var mi *metainfo.MetaInfo
+	if ok {
+		mi = p.mi
+	}
+	s.previewMu.Unlock()
+	if !ok {
+		return nil, ErrPreviewNotFound
+	}
+	if mi == nil {
+		return nil, ErrPreviewNotReady
+	}
+	if _, err := s.stateManager.GetTorrent(infoHash); err == nil {
+		return nil, ErrTorrentExists
+	}
+
+	added, err := s.addTorrentMetaInfo(mi, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.previewMu.Lock()
+	if s.previews[infoHash] == p {
+		delete(s.previews, infoHash)
+	}
+	s.previewMu.Unlock()
+	log.Printf("[service] Preview of %s (%s) confirmed", added.Name, infoHash)
+
+	return added, nil
+}
+
+// CancelPreview discards a preview and stops resolving its metadata.
+func (s *Service) CancelPreview(infoHash string) error {
+	s.previewMu.Lock()
+	p, ok := s.previews[infoHash]
+	delete(s.previews, infoHash)
+	s.previewMu.Unlock()
+	if !ok {
+		return ErrPreviewNotFound
+	}
+	p.cancel()
+	return nil
+}
+
+// runPreviewCleanup удаляет предпросмотры, которые не подтвердили за previewTTL
+func (s *Service) runPreviewCleanup() {
+	ticker := time.NewTicker(previewCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			s.previewMu.Lock()
+			for infoHash, p := range s.previews {
+				if now.After(p.ExpiresAt) {
+					p.cancel()
+					delete(s.previews, infoHash)
+					log.Printf("[service] Preview of %s expired", infoHash)
+				}
+			}
+			s.previewMu.Unlock()
+		}
+	}
+}
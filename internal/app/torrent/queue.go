@@ -0,0 +1,178 @@
+package torrent
+
+import (
+	"log"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// queueInterval период пересчёта очереди, помимо пересчёта после изменений
+const queueInterval = 2 * time.Second
+
+// QueueLimits ограничивает число одновременно активных торрентов, 0 — без ограничения
+type QueueLimits struct {
+	MaxDownloads int `json:"maxDownloads"`
+	MaxSeeds     int `json:"maxSeeds"`
+}
+
+// queueStatus сведения о торренте клиента, нужные очереди
+type queueStatus struct {
+	// known — торрент загружен в клиент и его метаданные получены
+	known bool
+	// empty — ни один файл не выбран для загрузки, торрент не загружает и не раздаёт
+	empty  bool
+	done   bool
+	paused bool
+	queued bool
+}
+
+// queueStatus returns what the download queue needs to know about a torrent.
+func (c *Client) queueStatus(infoHash string) queueStatus {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok || t.Info() == nil {
+		return queueStatus{}
+	}
+
+	selected, completed := selectedBytes(t)
+	held := c.throttle.held(t.InfoHash())
+	return queueStatus{
+		known:  true,
+		empty:  selected == 0,
+		done:   selected > 0 && completed == selected,
+		paused: held&holdPaused != 0,
+		queued: held&holdQueued != 0,
+	}
+}
+
+// SetQueued holds a torrent in the download queue or lets it exchange data.
+func (c *Client) SetQueued(infoHash string, queued bool) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return
+	}
+	if queued {
+		c.throttle.hold(t, holdQueued)
+	} else {
+		c.throttle.unhold(t, holdQueued)
+	}
+}
+
+// runQueue пересчитывает очередь периодически и по запросу, пока не вызван Stop
+func (s *Service) runQueue() {
+	ticker := time.NewTicker(queueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		case <-s.queueKick:
+		}
+		s.applyQueue()
+	}
+}
+
+// kickQueue просит пересчитать очередь, не дожидаясь следующего периода
+func (s *Service) kickQueue() {
+	select {
+	case s.queueKick <- struct{}{}:
+	default:
+	}
+}
+
+// applyQueue запускает торренты в порядке очереди в пределах ограничений, остальные ставит в ожидание
+func (s *Service) applyQueue() {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	ordered := s.stateManager.QueueOrder()
+	statuses := make(map[string]queueStatus, len(ordered))
+	for _, t := range ordered {
+		statuses[t.InfoHash] = s.client.queueStatus(t.InfoHash)
+	}
+
+	plan := planQueue(ordered, statuses, s.queueLimits)
+	for _, t := range ordered {
+		queued, counted := plan[t.InfoHash]
+		if !counted || queued == statuses[t.InfoHash].queued {
+			continue
+		}
+		s.client.SetQueued(t.InfoHash, queued)
+		if queued {
+			log.Printf("[queue] %s is waiting in the queue", t.Name)
+		} else {
+			log.Printf("[queue] %s started from the queue", t.Name)
+		}
+	}
+}
+
+// planQueue решает, какие торренты должны ждать в очереди, проходя их в порядке очереди.
+// Приостановленные и ещё не получившие метаданные торренты не учитываются и в результат не попадают,
+// принудительно запущенные и торренты без выбранных файлов не ждут и не занимают места.
+func planQueue(ordered []Torrent, statuses map[string]queueStatus, limits QueueLimits) map[string]bool {
+	plan := make(map[string]bool, len(ordered))
+	downloads, seeds := 0, 0
+
+	for _, t := range ordered {
+		status := statuses[t.InfoHash]
+		if !status.known || status.paused {
+			continue
+		}
+
+		queued := false
+		switch {
+		case t.ForceStart, status.empty:
+		case status.done:
+			seeds++
+			queued = limits.MaxSeeds > 0 && seeds > limits.MaxSeeds
+		default:
+			downloads++
+			queued = limits.MaxDownloads > 0 && downloads > limits.MaxDownloads
+		}
+		plan[t.InfoHash] = queued
+	}
+	return plan
+}
+
+// GetQueue returns the torrents in queue order with their current state.
+func (s *Service) GetQueue() []Torrent {
+	ordered := s.stateManager.QueueOrder()
+	for i := range ordered {
+		if active, err := s.client.GetTorrent(ordered[i].InfoHash); err == nil {
+			ordered[i].State = active.State
+		}
+	}
+	return ordered
+}
+
+// QueueLimits returns the limits of the download queue.
+func (s *Service) QueueLimits() QueueLimits {
+	return s.queueLimits
+}
+
+// MoveInQueue moves a torrent by delta places in the queue, negative values move it to the front.
+func (s *Service) MoveInQueue(infoHash string, delta int) error {
+	if err := s.stateManager.MoveInQueue(infoHash, delta); err != nil {
+		return err
+	}
+	s.kickQueue()
+	return nil
+}
+
+// SetForceStart starts a torrent regardless of the queue limits, or returns it to the queue.
+func (s *Service) SetForceStart(infoHash string, force bool) error {
+	if err := s.stateManager.SetForceStart(infoHash, force); err != nil {
+		return err
+	}
+	s.kickQueue()
+	return nil
+}
+
+// Stop stops the background work of the service.
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
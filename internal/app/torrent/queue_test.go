@@ -0,0 +1,141 @@
+package torrent
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestPlanQueue(t *testing.T) {
+	downloading := queueStatus{known: true}
+	done := queueStatus{known: true, done: true}
+
+	tests := []struct {
+		name     string
+		ordered  []Torrent
+		statuses map[string]queueStatus
+		limits   QueueLimits
+		want     map[string]bool
+	}{
+		{
+			name:     "no limits start everything",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}, {InfoHash: "c"}},
+			statuses: map[string]queueStatus{"a": downloading, "b": downloading, "c": done},
+			want:     map[string]bool{"a": false, "b": false, "c": false},
+		},
+		{
+			name:     "downloads over the limit wait in queue order",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}, {InfoHash: "c"}},
+			statuses: map[string]queueStatus{"a": downloading, "b": downloading, "c": downloading},
+			limits:   QueueLimits{MaxDownloads: 2},
+			want:     map[string]bool{"a": false, "b": false, "c": true},
+		},
+		{
+			name:     "seeds and downloads are limited separately",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}, {InfoHash: "c"}, {InfoHash: "d"}},
+			statuses: map[string]queueStatus{"a": done, "b": downloading, "c": done, "d": downloading},
+			limits:   QueueLimits{MaxDownloads: 1, MaxSeeds: 1},
+			want:     map[string]bool{"a": false, "b": false, "c": true, "d": true},
+		},
+		{
+			name:     "force started torrents do not take a place",
+			ordered:  []Torrent{{InfoHash: "a", ForceStart: true}, {InfoHash: "b"}, {InfoHash: "c", ForceStart: true}, {InfoHash: "d"}},
+			statuses: map[string]queueStatus{"a": downloading, "b": downloading, "c": downloading, "d": downloading},
+			limits:   QueueLimits{MaxDownloads: 1},
+			want:     map[string]bool{"a": false, "b": false, "c": false, "d": true},
+		},
+		{
+			name:    "paused and unknown torrents are skipped",
+			ordered: []Torrent{{InfoHash: "a"}, {InfoHash: "b"}, {InfoHash: "c"}, {InfoHash: "d"}},
+			statuses: map[string]queueStatus{
+				"a": {known: true, paused: true},
+				"b": {},
+				"c": {known: true, queued: true},
+			},
+			limits: QueueLimits{MaxDownloads: 1},
+			want:   map[string]bool{"c": false},
+		},
+		{
+			name:     "torrent without selected files is neither a download nor a seed",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}, {InfoHash: "c"}},
+			statuses: map[string]queueStatus{"a": {known: true, empty: true}, "b": done, "c": downloading},
+			limits:   QueueLimits{MaxDownloads: 1, MaxSeeds: 1},
+			want:     map[string]bool{"a": false, "b": false, "c": false},
+		},
+		{
+			name:     "torrent without selected files leaves the queue",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}},
+			statuses: map[string]queueStatus{"a": downloading, "b": {known: true, empty: true, queued: true}},
+			limits:   QueueLimits{MaxDownloads: 1},
+			want:     map[string]bool{"a": false, "b": false},
+		},
+		{
+			name:     "queued torrent is released when a place frees up",
+			ordered:  []Torrent{{InfoHash: "a"}, {InfoHash: "b"}},
+			statuses: map[string]queueStatus{"a": done, "b": {known: true, queued: true}},
+			limits:   QueueLimits{MaxDownloads: 1},
+			want:     map[string]bool{"a": false, "b": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planQueue(tt.ordered, tt.statuses, tt.limits)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("planQueue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveInQueue(t *testing.T) {
+	tests := []struct {
+		name  string
+		hash  string
+		delta int
+		want  []string
+	}{
+		{name: "one place back", hash: "a", delta: 1, want: []string{"b", "a", "c", "d"}},
+		{name: "to the front", hash: "c", delta: -2, want: []string{"c", "a", "b", "d"}},
+		{name: "past the end stops at the end", hash: "b", delta: 10, want: []string{"a", "c", "d", "b"}},
+		{name: "past the front stops at the front", hash: "d", delta: -10, want: []string{"d", "a", "b", "c"}},
+		{name: "zero keeps the order", hash: "b", delta: 0, want: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Места с пропусками, как после удаления торрентов
+			sm := &StateManager{
+				states: map[string]*Torrent{
+					"a": {InfoHash: "a", QueuePosition: 1},
+					"b": {InfoHash: "b", QueuePosition: 3},
+					"c": {InfoHash: "c", QueuePosition: 4},
+					"d": {InfoHash: "d", QueuePosition: 7},
+				},
+				saveChannel: make(chan struct{}, 1),
+			}
+
+			if err := sm.MoveInQueue(tt.hash, tt.delta); err != nil {
+				t.Fatalf("MoveInQueue() error = %v", err)
+			}
+
+			var got []string
+			for i, torrent := range sm.QueueOrder() {
+				got = append(got, torrent.InfoHash)
+				if tt.delta != 0 && torrent.QueuePosition != i+1 {
+					t.Errorf("%s has position %d, want %d", torrent.InfoHash, torrent.QueuePosition, i+1)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queue order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveInQueueUnknownTorrent(t *testing.T) {
+	sm := &StateManager{states: map[string]*Torrent{}, saveChannel: make(chan struct{}, 1)}
+	if err := sm.MoveInQueue("missing", 1); err == nil {
+		t.Error("MoveInQueue() of an unknown torrent returned no error")
+	}
+}
@@ -0,0 +1,160 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrRecheckInProgress is returned when a torrent is already being rechecked.
+var ErrRecheckInProgress = errors.New("torrent is already being rechecked")
+
+// RecheckProgress ход проверки данных торрента, не сохраняется в состояние
+type RecheckProgress struct {
+	CheckedPieces int `json:"checkedPieces"`
+	TotalPieces   int `json:"totalPieces"`
+	// ValidPieces части, которые прошли проверку хеша
+	ValidPieces int `json:"validPieces"`
+	// InvalidatedPieces части, которые считались загруженными, но не прошли проверку
+	InvalidatedPieces int       `json:"invalidatedPieces"`
+	Percent           float32   `json:"percent"`
+	StartedAt         time.Time `json:"startedAt"`
+}
+
+// RecheckResult итог проверки данных торрента
+type RecheckResult struct {
+	RecheckProgress
+	Err error
+}
+
+// rechecks ход проверок, которые выполняются сейчас
+type rechecks struct {
+	mu       sync.Mutex
+	progress map[metainfo.Hash]*RecheckProgress
+	// cancels останавливают проверки при удалении торрента и закрытии клиента
+	cancels map[metainfo.Hash]context.CancelFunc
+}
+
+func newRechecks() *rechecks {
+	return &rechecks{
+		progress: make(map[metainfo.Hash]*RecheckProgress),
+		cancels:  make(map[metainfo.Hash]context.CancelFunc),
+	}
+}
+
+// get возвращает копию хода проверки или nil, если торрент не проверяется
+func (r *rechecks) get(hash metainfo.Hash) *RecheckProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.progress[hash]
+	if !ok {
+		return nil
+	}
+	progress := *p
+	return &progress
+}
+
+// forget останавливает проверку удалённого из клиента торрента и удаляет её ход
+func (r *rechecks) forget(hash metainfo.Hash) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cancel, ok := r.cancels[hash]; ok {
+		cancel()
+		delete(r.cancels, hash)
+	}
+	delete(r.progress, hash)
+}
+
+// stop останавливает все проверки
+func (r *rechecks) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, cancel := range r.cancels {
+		cancel()
+		delete(r.cancels, hash)
+	}
+}
+
+// StartRecheck re-hashes every piece of a torrent in the background and corrects its piece completion.
+// Pieces that fail the check are downloaded again. The result is sent to the returned channel.
+func (c *Client) StartRecheck(infoHash string) (<-chan RecheckResult, error) {
+	hash := metainfo.NewHashFromHex(infoHash)
+	t, ok := c.tClient.Torrent(hash)
+	if !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+
+	c.rechecks.mu.Lock()
+	if _, running := c.rechecks.progress[hash]; running {
+		c.rechecks.mu.Unlock()
+		return nil, ErrRecheckInProgress
+	}
+	progress := &RecheckProgress{TotalPieces: t.NumPieces(), StartedAt: time.Now()}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.rechecks.progress[hash] = progress
+	c.rechecks.cancels[hash] = cancel
+	c.rechecks.mu.Unlock()
+
+	results := make(chan RecheckResult, 1)
+	go func() {
+		err := c.recheck(ctx, t, progress)
+
+		c.rechecks.mu.Lock()
+		result := RecheckResult{RecheckProgress: *progress, Err: err}
+		if c.rechecks.progress[hash] == progress {
+			delete(c.rechecks.progress, hash)
+			delete(c.rechecks.cancels, hash)
+		}
+		c.rechecks.mu.Unlock()
+		cancel()
+
+		results <- result
+	}()
+
+	return results, nil
+}
+
+// recheck проверяет части по одной, обновляя progress, пока ctx не отменён и торрент не закрыт
+func (c *Client) recheck(ctx context.Context, t *torrent.Torrent, progress *RecheckProgress) error {
+	for i := 0; i < progress.TotalPieces; i++ {
+		piece := t.Piece(i)
+		wasComplete := piece.State().Complete
+
+		// VerifyData ждёт окончания хеширования и не прерывается, поэтому ожидание вынесено в горутину
+		verified := make(chan struct{})
+		go func() {
+			defer close(verified)
+			piece.VerifyData()
+		}()
+		select {
+		case <-verified:
+		case <-t.Closed():
+			return fmt.Errorf("torrent %s was closed during recheck", t.InfoHash().HexString())
+		case <-ctx.Done():
+			return fmt.Errorf("recheck of %s stopped: %w", t.InfoHash().HexString(), ctx.Err())
+		}
+		valid := piece.State().Complete
+
+		c.rechecks.mu.Lock()
+		progress.CheckedPieces++
+		if valid {
+			progress.ValidPieces++
+		} else if wasComplete {
+			progress.InvalidatedPieces++
+		}
+		progress.Percent = getPercent(int64(progress.CheckedPieces), int64(progress.TotalPieces))
+		c.rechecks.mu.Unlock()
+	}
+	return nil
+}
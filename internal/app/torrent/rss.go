@@ -0,0 +1,707 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFeedNotFound is returned for an unknown feed ID.
+	ErrFeedNotFound = errors.New("feed not found")
+	// ErrFeedRuleNotFound is returned for an unknown rule ID.
+	ErrFeedRuleNotFound = errors.New("feed rule not found")
+	// ErrInvalidFeed is returned for feed or rule settings that can't be used.
+	ErrInvalidFeed = errors.New("invalid feed settings")
+)
+
+const (
+	// DefaultFeedInterval период опроса ленты, если он не задан
+	DefaultFeedInterval = 30 * time.Minute
+	// minFeedInterval не даёт опрашивать ленты чаще, чем это разумно для трекеров
+	minFeedInterval = time.Minute
+	// feedCheckInterval как часто проверяется, не пора ли опросить ленты
+	feedCheckInterval = 30 * time.Second
+	// maxFeedSize ограничивает размер загружаемой ленты
+	maxFeedSize = 10 << 20
+	// maxGrabbedPerFeed сколько добавленных GUID помнится для ленты, старые забываются первыми
+	maxGrabbedPerFeed = 1000
+)
+
+// Feed RSS или Atom лента с правилами автоматического добавления раздач
+type Feed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Interval период опроса вида "30m", по умолчанию DefaultFeedInterval
+	Interval string     `json:"interval"`
+	Disabled bool       `json:"disabled,omitempty"`
+	Rules    []FeedRule `json:"rules"`
+	// LastChecked и LastError время и ошибка последнего опроса
+	LastChecked *time.Time `json:"lastChecked,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// FeedRule правило отбора раздач ленты. Раздача добавляется по первому подходящему правилу.
+type FeedRule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// Include и Exclude регулярные выражения для названия раздачи, регистр не учитывается.
+	// Пустой Include подходит к любому названию.
+	Include string `json:"include,omitempty"`
+	Exclude string `json:"exclude,omitempty"`
+	// MinSize и MaxSize ограничения размера в байтах, 0 — без ограничения.
+	// Раздачи неизвестного размера под правило с ограничениями не подходят.
+	MinSize     int64  `json:"minSize,omitempty"`
+	MaxSize     int64  `json:"maxSize,omitempty"`
+	SavePath    string `json:"savePath,omitempty"`
+	AutoConvert *bool  `json:"autoConvert,omitempty"`
+}
+
+// FeedRuleMatch результат проверки правила на раздаче ленты
+type FeedRuleMatch struct {
+	FeedItem
+	Matched bool `json:"matched"`
+	// Reason почему раздача не подошла
+	Reason string `json:"reason,omitempty"`
+	// Grabbed раздача уже была добавлена из этой ленты
+	Grabbed bool `json:"grabbed"`
+}
+
+// interval возвращает период опроса ленты
+func (f *Feed) interval() time.Duration {
+	d, err := time.ParseDuration(f.Interval)
+	if err != nil {
+		return DefaultFeedInterval
+	}
+	return d
+}
+
+// normalize проверяет параметры ленты и заполняет значения по умолчанию
+func (f *Feed) normalize() error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.URL = strings.TrimSpace(f.URL)
+	u, err := url.Parse(f.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("feed URL %q must be an http(s) URL: %w", f.URL, ErrInvalidFeed)
+	}
+	if f.Name == "" {
+		f.Name = u.Host
+	}
+
+	if f.Interval == "" {
+		f.Interval = DefaultFeedInterval.String()
+	}
+	d, err := time.ParseDuration(f.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid interval %q: %w", f.Interval, ErrInvalidFeed)
+	}
+	if d < minFeedInterval {
+		return fmt.Errorf("interval must be at least %s: %w", minFeedInterval, ErrInvalidFeed)
+	}
+	return nil
+}
+
+// compiledRule правило с разобранными регулярными выражениями
+type compiledRule struct {
+	FeedRule
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// compile проверяет правило и разбирает его регулярные выражения
+func (r FeedRule) compile() (*compiledRule, error) {
+	if r.MinSize < 0 || r.MaxSize < 0 {
+		return nil, fmt.Errorf("size limits must not be negative: %w", ErrInvalidFeed)
+	}
+	if r.MaxSize != 0 && r.MinSize > r.MaxSize {
+		return nil, fmt.Errorf("minSize must not exceed maxSize: %w", ErrInvalidFeed)
+	}
+
+	c := &compiledRule{FeedRule: r}
+	var err error
+	if r.Include != "" {
+		if c.include, err = regexp.Compile("(?i)" + r.Include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %v: %w", err, ErrInvalidFeed)
+		}
+	}
+	if r.Exclude != "" {
+		if c.exclude, err = regexp.Compile("(?i)" + r.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %v: %w", err, ErrInvalidFeed)
+		}
+	}
+	return c, nil
+}
+
+// match проверяет раздачу и возвращает причину, по которой она не подошла
+func (c *compiledRule) match(item FeedItem) (bool, string) {
+	if c.include != nil && !c.include.MatchString(item.Title) {
+		return false, "title does not match include pattern"
+	}
+	if c.exclude != nil && c.exclude.MatchString(item.Title) {
+		return false, "title matches exclude pattern"
+	}
+	if (c.MinSize > 0 || c.MaxSize > 0) && item.Size == 0 {
+		return false, "size is unknown"
+	}
+	if c.MinSize > 0 && item.Size < c.MinSize {
+		return false, "smaller than minSize"
+	}
+	if c.MaxSize > 0 && item.Size > c.MaxSize {
+		return false, "larger than maxSize"
+	}
+	return true, ""
+}
+
+// feedsFile содержимое файла лент
+type feedsFile struct {
+	Feeds []*Feed `json:"feeds"`
+	// Grabbed время добавления раздач по GUID для каждой ленты
+	Grabbed map[string]map[string]time.Time `json:"grabbed"`
+}
+
+// FeedManager опрашивает RSS и Atom ленты и добавляет подходящие под правила раздачи
+type FeedManager struct {
+	service *Service
+	path    string
+
+	mu      sync.Mutex
+	feeds   []*Feed
+	grabbed map[string]map[string]time.Time
+	// polling ленты, которые опрашиваются сейчас
+	polling map[string]bool
+
+	kick     chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewFeedManager создаёт менеджер лент, которые хранятся в файле path
+func NewFeedManager(service *Service, path string) *FeedManager {
+	return &FeedManager{
+		service:  service,
+		path:     path,
+		grabbed:  make(map[string]map[string]time.Time),
+		polling:  make(map[string]bool),
+		kick:     make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start загружает ленты из файла и начинает их опрос
+func (m *FeedManager) Start() error {
+	if err := m.load(); err != nil {
+		return err
+	}
+	log.Printf("[rss] Loaded %d feeds from %s", len(m.feeds), m.path)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(feedCheckInterval)
+		defer ticker.Stop()
+
+		m.pollDue()
+		for {
+			select {
+			case <-m.stopChan:
+				return
+			case <-ticker.C:
+				m.pollDue()
+			case <-m.kick:
+				m.pollDue()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop останавливает опрос и ждёт окончания текущего
+func (m *FeedManager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
+	m.wg.Wait()
+}
+
+// load читает файл лент, отсутствие файла не считается ошибкой
+func (m *FeedManager) load() error {
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file feedsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to decode feeds: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.feeds = file.Feeds
+	for id, guids := range file.Grabbed {
+		m.grabbed[id] = guids
+	}
+	return nil
+}
+
+// save записывает ленты во временный файл и заменяет им прежний. Вызывается под m.mu.
+func (m *FeedManager) save() error {
+	data, err := json.MarshalIndent(feedsFile{Feeds: m.feeds, Grabbed: m.grabbed}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write feeds: %w", err)
+	}
+	if err := os.Rename(m.path+".tmp", m.path); err != nil {
+		filehelpers.OsRemove(m.path + ".tmp")
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
+
+// find возвращает ленту по ID. Вызывается под m.mu.
+func (m *FeedManager) find(id string) (*Feed, error) {
+	for _, f := range m.feeds {
+		if f.ID == id {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("feed %s: %w", id, ErrFeedNotFound)
+}
+
+// copyFeed возвращает копию ленты, которую можно отдать наружу
+func copyFeed(f *Feed) Feed {
+	feed := *f
+	feed.Rules = append([]FeedRule{}, f.Rules...)
+	return feed
+}
+
+// Feeds returns all feeds with their rules.
+func (m *FeedManager) Feeds() []Feed {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	feeds := make([]Feed, 0, len(m.feeds))
+	for _, f := range m.feeds {
+		feeds = append(feeds, copyFeed(f))
+	}
+	return feeds
+}
+
+// Feed returns a feed by ID.
+func (m *FeedManager) Feed(id string) (Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.find(id)
+	if err != nil {
+		return Feed{}, err
+	}
+	return copyFeed(f), nil
+}
+
+// AddFeed adds a feed with its rules. The feed is polled right away.
+func (m *FeedManager) AddFeed(feed Feed) (Feed, error) {
+	if err := feed.normalize(); err != nil {
+		return Feed{}, err
+	}
+	for i := range feed.Rules {
+		if err := m.validateRule(&feed.Rules[i]); err != nil {
+			return Feed{}, err
+		}
+		feed.Rules[i].ID = newFeedID()
+	}
+	if feed.Rules == nil {
+		feed.Rules = []FeedRule{}
+	}
+	feed.ID = newFeedID()
+	feed.LastChecked = nil
+	feed.LastError = ""
+
+	m.mu.Lock()
+	m.feeds = append(m.feeds, &feed)
+	err := m.save()
+	result := copyFeed(&feed)
+	m.mu.Unlock()
+	if err != nil {
+		return Feed{}, err
+	}
+
+	log.Printf("[rss] Feed %s added: %s", feed.ID, feed.URL)
+	m.pollSoon()
+	return result, nil
+}
+
+// UpdateFeed changes the name, URL, interval and disabled flag of a feed. Its rules are kept.
+func (m *FeedManager) UpdateFeed(id string, update Feed) (Feed, error) {
+	if err := update.normalize(); err != nil {
+		return Feed{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.find(id)
+	if err != nil {
+		return Feed{}, err
+	}
+	if f.URL != update.URL {
+		// Новая лента опрашивается сразу
+		f.LastChecked = nil
+		f.LastError = ""
+	}
+	f.Name = update.Name
+	f.URL = update.URL
+	f.Interval = update.Interval
+	f.Disabled = update.Disabled
+	if err := m.save(); err != nil {
+		return Feed{}, err
+	}
+	// Включённая лента или лента с меньшим периодом могла стать готовой к опросу
+	m.pollSoon()
+	return copyFeed(f), nil
+}
+
+// DeleteFeed removes a feed together with its rules and remembered GUIDs.
+func (m *FeedManager) DeleteFeed(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, f := range m.feeds {
+		if f.ID == id {
+			m.feeds = append(m.feeds[:i], m.feeds[i+1:]...)
+			delete(m.grabbed, id)
+			log.Printf("[rss] Feed %s removed", id)
+			return m.save()
+		}
+	}
+	return fmt.Errorf("feed %s: %w", id, ErrFeedNotFound)
+}
+
+// validateRule проверяет правило и папку сохранения
+func (m *FeedManager) validateRule(rule *FeedRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if _, err := rule.compile(); err != nil {
+		return err
+	}
+	if _, err := m.service.client.ResolveSavePath(rule.SavePath); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddRule adds a rule to a feed.
+func (m *FeedManager) AddRule(feedID string, rule FeedRule) (FeedRule, error) {
+	if err := m.validateRule(&rule); err != nil {
+		return FeedRule{}, err
+	}
+	rule.ID = newFeedID()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.find(feedID)
+	if err != nil {
+		return FeedRule{}, err
+	}
+	f.Rules = append(f.Rules, rule)
+	if err := m.save(); err != nil {
+		return FeedRule{}, err
+	}
+	return rule, nil
+}
+
+// UpdateRule replaces a rule of a feed.
+func (m *FeedManager) UpdateRule(feedID, ruleID string, rule FeedRule) (FeedRule, error) {
+	if err := m.validateRule(&rule); err != nil {
+		return FeedRule{}, err
+	}
+	rule.ID = ruleID
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.find(feedID)
+	if err != nil {
+		return FeedRule{}, err
+	}
+	for i := range f.Rules {
+		if f.Rules[i].ID == ruleID {
+			f.Rules[i] = rule
+			if err := m.save(); err != nil {
+				return FeedRule{}, err
+			}
+			return rule, nil
+		}
+	}
+	return FeedRule{}, fmt.Errorf("rule %s: %w", ruleID, ErrFeedRuleNotFound)
+}
+
+// DeleteRule removes a rule from a feed.
+func (m *FeedManager) DeleteRule(feedID, ruleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.find(feedID)
+	if err != nil {
+		return err
+	}
+	for i := range f.Rules {
+		if f.Rules[i].ID == ruleID {
+			f.Rules = append(f.Rules[:i], f.Rules[i+1:]...)
+			return m.save()
+		}
+	}
+	return fmt.Errorf("rule %s: %w", ruleID, ErrFeedRuleNotFound)
+}
+
+// TestRule checks a rule against the current items of a feed without adding anything.
+// The rule doesn't have to be saved.
+func (m *FeedManager) TestRule(ctx context.Context, feedID string, rule FeedRule) ([]FeedRuleMatch, error) {
+	compiled, err := rule.compile()
+	if err != nil {
+		return nil, err
+	}
+	feed, err := m.Feed(feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := m.fetchFeed(ctx, feed.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	grabbed := m.grabbed[feedID]
+	matches := make([]FeedRuleMatch, 0, len(items))
+	for _, item := range items {
+		matched, reason := compiled.match(item)
+		_, wasGrabbed := grabbed[item.GUID]
+		matches = append(matches, FeedRuleMatch{FeedItem: item, Matched: matched, Reason: reason, Grabbed: wasGrabbed})
+	}
+	m.mu.Unlock()
+	return matches, nil
+}
+
+// RefreshFeed polls a feed right away, even if it is disabled, and returns its state afterwards.
+func (m *FeedManager) RefreshFeed(ctx context.Context, feedID string) (Feed, error) {
+	if _, err := m.Feed(feedID); err != nil {
+		return Feed{}, err
+	}
+	m.poll(ctx, feedID)
+	return m.Feed(feedID)
+}
+
+// pollSoon просит цикл опроса проверить ленты, не дожидаясь тикера
+func (m *FeedManager) pollSoon() {
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// pollDue опрашивает включённые ленты, для которых прошёл их период
+func (m *FeedManager) pollDue() {
+	now := time.Now()
+	var due []string
+	m.mu.Lock()
+	for _, f := range m.feeds {
+		if !f.Disabled && (f.LastChecked == nil || now.Sub(*f.LastChecked) >= f.interval()) {
+			due = append(due, f.ID)
+		}
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-m.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for _, id := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		m.poll(ctx, id)
+	}
+}
+
+// poll загружает ленту и добавляет раздачи, подходящие под её правила
+func (m *FeedManager) poll(ctx context.Context, feedID string) {
+	m.mu.Lock()
+	f, err := m.find(feedID)
+	if err != nil || m.polling[feedID] {
+		m.mu.Unlock()
+		return
+	}
+	m.polling[feedID] = true
+	feed := copyFeed(f)
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.polling, feedID)
+		m.mu.Unlock()
+	}()
+
+	items, fetchErr := m.fetchFeed(ctx, feed.URL)
+	if fetchErr != nil {
+		log.Printf("[rss] Failed to fetch feed %s: %v", feed.URL, fetchErr)
+	}
+
+	var rules []*compiledRule
+	for _, rule := range feed.Rules {
+		if rule.Disabled {
+			continue
+		}
+		compiled, err := rule.compile()
+		if err != nil {
+			log.Printf("[rss] Skipping rule %s of feed %s: %v", rule.ID, feed.ID, err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+
+	var newlyGrabbed []string
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if m.isGrabbed(feedID, item.GUID) {
+			continue
+		}
+		for _, rule := range rules {
+			if ok, _ := rule.match(item); !ok {
+				continue
+			}
+			if err := m.grab(ctx, feed, rule.FeedRule, item); err != nil {
+				// Раздача не запоминается и будет добавлена при следующем опросе
+				log.Printf("[rss] Failed to add %q from feed %s: %v", item.Title, feed.Name, err)
+			} else {
+				newlyGrabbed = append(newlyGrabbed, item.GUID)
+			}
+			break
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Лента могла быть удалена во время опроса
+	f, err = m.find(feedID)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	f.LastChecked = &now
+	f.LastError = ""
+	if fetchErr != nil {
+		f.LastError = fetchErr.Error()
+	}
+	if len(newlyGrabbed) > 0 {
+		if m.grabbed[feedID] == nil {
+			m.grabbed[feedID] = make(map[string]time.Time)
+		}
+		for _, guid := range newlyGrabbed {
+			m.grabbed[feedID][guid] = now
+		}
+		pruneGrabbed(m.grabbed[feedID])
+	}
+	if err := m.save(); err != nil {
+		log.Printf("[rss] Failed to save feeds: %v", err)
+	}
+}
+
+func (m *FeedManager) isGrabbed(feedID, guid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.grabbed[feedID][guid]
+	return ok
+}
+
+// grab добавляет раздачу с параметрами правила
+func (m *FeedManager) grab(ctx context.Context, feed Feed, rule FeedRule, item FeedItem) error {
+	opts := AddOptions{SavePath: rule.SavePath, AutoConvert: rule.AutoConvert}
+
+	// Ссылка загружается в контексте опроса, чтобы Stop не ждал её
+	infoHash, err := m.service.AddTorrentContext(ctx, item.Source, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[rss] Added %q (%s) from feed %s by rule %q", item.Title, infoHash, feed.Name, rule.Name)
+	torrent, err := m.service.stateManager.GetTorrent(infoHash)
+	if err != nil {
+		torrent = &Torrent{InfoHash: infoHash, Name: item.Title}
+	}
+	m.service.stateManager.SendEvent(Event{
+		Type:      "rss_grabbed",
+		Torrent:   torrent,
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
+// fetchFeed загружает и разбирает ленту
+func (m *FeedManager) fetchFeed(ctx context.Context, feedURL string) ([]FeedItem, error) {
+	data, err := fetchURL(ctx, feedURL, maxFeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(bytes.NewReader(data))
+}
+
+// pruneGrabbed оставляет maxGrabbedPerFeed последних добавленных GUID
+func pruneGrabbed(guids map[string]time.Time) {
+	if len(guids) <= maxGrabbedPerFeed {
+		return
+	}
+	keys := make([]string, 0, len(guids))
+	for guid := range guids {
+		keys = append(keys, guid)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return guids[keys[i]].Before(guids[keys[j]])
+	})
+	for _, guid := range keys[:len(keys)-maxGrabbedPerFeed] {
+		delete(guids, guid)
+	}
+}
+
+// newFeedID возвращает случайный идентификатор ленты или правила
+func newFeedID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,264 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	magnet := "magnet:?xt=urn:btih:" + testHashX
+	published := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		feed    string
+		want    []FeedItem
+		wantErr bool
+	}{
+		{
+			name: "rss prefers the magnet link",
+			feed: `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/"><channel>
+	<item>
+		<title> Show S01E01 </title>
+		<guid>show-1</guid>
+		<link>http://tracker.example/show-1.torrent</link>
+		<pubDate>Fri, 01 Mar 2024 12:00:00 +0000</pubDate>
+		<enclosure url="http://tracker.example/download/1" length="1000" type="application/x-bittorrent"/>
+		<torrent:magnetURI>` + magnet + `</torrent:magnetURI>
+		<torrent:contentLength>5000</torrent:contentLength>
+	</item>
+</channel></rss>`,
+			want: []FeedItem{{Title: "Show S01E01", GUID: "show-1", Source: magnet, Size: 5000, Published: &published}},
+		},
+		{
+			name: "torznab magnet and size attributes",
+			feed: `<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed"><channel>
+	<item>
+		<title>Movie</title>
+		<link>http://indexer.example/dl/1</link>
+		<torznab:attr name="size" value="7000"/>
+		<torznab:attr name="magneturl" value="` + magnet + `"/>
+	</item>
+</channel></rss>`,
+			want: []FeedItem{{Title: "Movie", GUID: magnet, Source: magnet, Size: 7000}},
+		},
+		{
+			name: "enclosure before a torrent link, guid falls back to the source",
+			feed: `<rss version="2.0"><channel>
+	<item>
+		<title>Enclosure</title>
+		<link>http://tracker.example/e.torrent</link>
+		<enclosure url="http://tracker.example/download/e" length="300"/>
+	</item>
+	<item>
+		<title>Link</title>
+		<link>http://tracker.example/l.torrent?passkey=1</link>
+		<size>200</size>
+	</item>
+	<item>
+		<title>Page only</title>
+		<link>http://tracker.example/details/3</link>
+	</item>
+</channel></rss>`,
+			want: []FeedItem{
+				{Title: "Enclosure", GUID: "http://tracker.example/download/e", Source: "http://tracker.example/download/e", Size: 300},
+				{Title: "Link", GUID: "http://tracker.example/l.torrent?passkey=1", Source: "http://tracker.example/l.torrent?passkey=1", Size: 200},
+			},
+		},
+		{
+			name: "atom",
+			feed: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<entry>
+		<title>Atom item</title>
+		<id>urn:atom:1</id>
+		<updated>2024-03-01T12:00:00Z</updated>
+		<link rel="alternate" href="http://tracker.example/details/1"/>
+		<link rel="enclosure" href="http://tracker.example/download/1" length="900"/>
+	</entry>
+	<entry>
+		<title>No torrent</title>
+		<link href="http://tracker.example/details/2"/>
+	</entry>
+</feed>`,
+			want: []FeedItem{{Title: "Atom item", GUID: "urn:atom:1", Source: "http://tracker.example/download/1", Size: 900, Published: &published}},
+		},
+		{
+			name: "empty channel",
+			feed: `<rss version="2.0"><channel></channel></rss>`,
+		},
+		{
+			name:    "unexpected root element",
+			feed:    `<html><body>Login required</body></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported charset",
+			feed:    `<?xml version="1.0" encoding="windows-1251"?><rss version="2.0"><channel></channel></rss>`,
+			wantErr: true,
+		},
+		{
+			name:    "not xml",
+			feed:    `{"items": []}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeed(strings.NewReader(tt.feed))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFeed() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseFeed() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.Title != w.Title || g.GUID != w.GUID || g.Source != w.Source || g.Size != w.Size {
+					t.Errorf("item %d = %+v, want %+v", i, g, w)
+				}
+				if (g.Published == nil) != (w.Published == nil) || (g.Published != nil && !g.Published.Equal(*w.Published)) {
+					t.Errorf("item %d published = %v, want %v", i, g.Published, w.Published)
+				}
+			}
+		})
+	}
+}
+
+func TestFeedRuleCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    FeedRule
+		wantErr bool
+	}{
+		{name: "empty rule", rule: FeedRule{}},
+		{name: "patterns and sizes", rule: FeedRule{Include: `S\d+E\d+`, Exclude: "cam", MinSize: 1, MaxSize: 2}},
+		{name: "only min size", rule: FeedRule{MinSize: 100}},
+		{name: "negative size", rule: FeedRule{MinSize: -1}, wantErr: true},
+		{name: "min size over max size", rule: FeedRule{MinSize: 10, MaxSize: 5}, wantErr: true},
+		{name: "invalid include", rule: FeedRule{Include: "("}, wantErr: true},
+		{name: "invalid exclude", rule: FeedRule{Exclude: "[a-"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rule.compile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidFeed) {
+				t.Errorf("compile() error = %v, want it to wrap ErrInvalidFeed", err)
+			}
+		})
+	}
+}
+
+func TestCompiledRuleMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       FeedRule
+		item       FeedItem
+		wantMatch  bool
+		wantReason string
+	}{
+		{name: "empty rule matches anything", item: FeedItem{Title: "Anything"}, wantMatch: true},
+		{
+			name:      "include ignores case",
+			rule:      FeedRule{Include: `show s\d+e\d+`},
+			item:      FeedItem{Title: "SHOW S01E02 1080p"},
+			wantMatch: true,
+		},
+		{
+			name:       "include does not match",
+			rule:       FeedRule{Include: "show"},
+			item:       FeedItem{Title: "Movie"},
+			wantReason: "title does not match include pattern",
+		},
+		{
+			name:       "exclude ignores case",
+			rule:       FeedRule{Include: "show", Exclude: "cam"},
+			item:       FeedItem{Title: "Show CAM"},
+			wantReason: "title matches exclude pattern",
+		},
+		{
+			name:       "unknown size with limits",
+			rule:       FeedRule{MaxSize: 1000},
+			item:       FeedItem{Title: "Show"},
+			wantReason: "size is unknown",
+		},
+		{
+			name:       "smaller than min size",
+			rule:       FeedRule{MinSize: 1000},
+			item:       FeedItem{Title: "Show", Size: 999},
+			wantReason: "smaller than minSize",
+		},
+		{
+			name:       "larger than max size",
+			rule:       FeedRule{MaxSize: 1000},
+			item:       FeedItem{Title: "Show", Size: 1001},
+			wantReason: "larger than maxSize",
+		},
+		{
+			name:      "size limits are inclusive",
+			rule:      FeedRule{MinSize: 1000, MaxSize: 1000},
+			item:      FeedItem{Title: "Show", Size: 1000},
+			wantMatch: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := tt.rule.compile()
+			if err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+			matched, reason := rule.match(tt.item)
+			if matched != tt.wantMatch || reason != tt.wantReason {
+				t.Errorf("match() = %v, %q, want %v, %q", matched, reason, tt.wantMatch, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPruneGrabbed(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	grabbed := func(n int) map[string]time.Time {
+		guids := make(map[string]time.Time, n)
+		for i := range n {
+			guids[fmt.Sprintf("guid-%d", i)] = start.Add(time.Duration(i) * time.Minute)
+		}
+		return guids
+	}
+
+	tests := []struct {
+		name       string
+		count      int
+		wantOldest int
+	}{
+		{name: "under the limit", count: 10, wantOldest: 0},
+		{name: "at the limit", count: maxGrabbedPerFeed, wantOldest: 0},
+		{name: "over the limit keeps the newest", count: maxGrabbedPerFeed + 25, wantOldest: 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guids := grabbed(tt.count)
+			pruneGrabbed(guids)
+
+			if want := min(tt.count, maxGrabbedPerFeed); len(guids) != want {
+				t.Fatalf("kept %d guids, want %d", len(guids), want)
+			}
+			for i := range tt.count {
+				_, kept := guids[fmt.Sprintf("guid-%d", i)]
+				if kept != (i >= tt.wantOldest) {
+					t.Fatalf("guid-%d kept = %v, want %v", i, kept, i >= tt.wantOldest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var (
+	// ErrNoIndexers is returned when no Torznab indexers are configured.
+	ErrNoIndexers = errors.New("no indexers are configured")
+	// ErrInvalidSearch is returned for a search query that can't be sent.
+	ErrInvalidSearch = errors.New("invalid search")
+	// ErrIndexersFailed is returned when none of the queried indexers answered.
+	ErrIndexersFailed = errors.New("all indexers failed")
+)
+
+const (
+	// DefaultSearchTimeout время ожидания ответа одного индексатора
+	DefaultSearchTimeout = 15 * time.Second
+	// maxSearchResponseSize ограничивает размер ответа индексатора
+	maxSearchResponseSize = 10 << 20
+)
+
+// Indexer Torznab индексатор, например Jackett или Prowlarr. Адрес не отдаётся наружу,
+// потому что в нём обычно есть apikey.
+type Indexer struct {
+	Name string `json:"name"`
+	URL  string `json:"-"`
+}
+
+// ParseIndexers разбирает индексаторы вида "имя=адрес"
+func ParseIndexers(specs []string) ([]Indexer, error) {
+	indexers := make([]Indexer, 0, len(specs))
+	for _, spec := range specs {
+		name, rawURL, ok := strings.Cut(spec, "=")
+		name, rawURL = strings.TrimSpace(name), strings.TrimSpace(rawURL)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("indexer %q must look like name=url", spec)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("indexer %s: URL must be an http(s) URL", name)
+		}
+		if slices.ContainsFunc(indexers, func(i Indexer) bool { return i.Name == name }) {
+			return nil, fmt.Errorf("indexer %s is listed twice", name)
+		}
+		indexers = append(indexers, Indexer{Name: name, URL: rawURL})
+	}
+	return indexers, nil
+}
+
+// SearchQuery параметры поиска
+type SearchQuery struct {
+	Query string
+	// Category категории Torznab через запятую, например "2000,5000"
+	Category string
+	// Indexers имена индексаторов, пустой список — все
+	Indexers []string
+}
+
+// SearchResult найденная раздача
+type SearchResult struct {
+	Title string `json:"title"`
+	// InfoHash пустой, если индексатор его не сообщил и нет магнет-ссылки
+	InfoHash string `json:"infoHash,omitempty"`
+	// Source магнет-ссылка или адрес .torrent файла для POST /api/torrents
+	Source    string     `json:"source"`
+	Size      int64      `json:"size"`
+	Seeders   int        `json:"seeders"`
+	Leechers  int        `json:"leechers"`
+	Published *time.Time `json:"published,omitempty"`
+	// Indexers индексаторы, которые нашли раздачу
+	Indexers []string `json:"indexers"`
+}
+
+// IndexerError ошибка одного из индексаторов, результаты остальных при этом возвращаются
+type IndexerError struct {
+	Indexer string `json:"indexer"`
+	Error   string `json:"error"`
+}
+
+// SearchResponse результаты поиска по всем индексаторам
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Errors  []IndexerError `json:"errors,omitempty"`
+}
+
+// Searcher ищет раздачи сразу во всех Torznab индексаторах
+type Searcher struct {
+	indexers []Indexer
+	timeout  time.Duration
+}
+
+// NewSearcher создаёт поиск по индексаторам, timeout ограничивает ожидание каждого из них
+func NewSearcher(indexers []Indexer, timeout time.Duration) *Searcher {
+	if timeout <= 0 {
+		timeout = DefaultSearchTimeout
+	}
+	return &Searcher{indexers: indexers, timeout: timeout}
+}
+
+// Indexers returns the configured indexers.
+func (s *Searcher) Indexers() []Indexer {
+	return slices.Clone(s.indexers)
+}
+
+// Search queries the indexers concurrently, each with its own timeout, and merges their results.
+// Results with the same info hash are returned once. Indexers that fail are reported in Errors,
+// unless all of them fail.
+func (s *Searcher) Search(ctx context.Context, query SearchQuery) (SearchResponse, error) {
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return SearchResponse{}, fmt.Errorf("query is required: %w", ErrInvalidSearch)
+	}
+	if len(s.indexers) == 0 {
+		return SearchResponse{}, ErrNoIndexers
+	}
+
+	var indexers []Indexer
+	for _, idx := range s.indexers {
+		if len(query.Indexers) == 0 || slices.Contains(query.Indexers, idx.Name) {
+			indexers = append(indexers, idx)
+		}
+	}
+	if len(indexers) == 0 {
+		return SearchResponse{}, fmt.Errorf("unknown indexers %v: %w", query.Indexers, ErrInvalidSearch)
+	}
+
+	results := make([][]SearchResult, len(indexers))
+	errs := make([]error, len(indexers))
+	var wg sync.WaitGroup
+	for i, idx := range indexers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			idxCtx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+			results[i], errs[i] = queryIndexer(idxCtx, idx, query)
+		}()
+	}
+	wg.Wait()
+
+	response := SearchResponse{}
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("[search] Indexer %s failed: %v", indexers[i].Name, err)
+			response.Errors = append(response.Errors, IndexerError{Indexer: indexers[i].Name, Error: err.Error()})
+			failed = append(failed, fmt.Errorf("%s: %w", indexers[i].Name, err))
+		}
+	}
+	if len(failed) == len(indexers) {
+		return SearchResponse{}, fmt.Errorf("%w: %w", ErrIndexersFailed, errors.Join(failed...))
+	}
+	response.Results = mergeSearchResults(results)
+	return response, nil
+}
+
+// queryIndexer выполняет поиск t=search в одном индексаторе
+func queryIndexer(ctx context.Context, idx Indexer, query SearchQuery) ([]SearchResult, error) {
+	u, err := url.Parse(idx.URL)
+	if err != nil {
+		return nil, err
+	}
+	values := u.Query()
+	values.Set("t", "search")
+	values.Set("q", query.Query)
+	if query.Category != "" {
+		values.Set("cat", query.Category)
+	}
+	u.RawQuery = values.Encode()
+
+	data, err := fetchURL(ctx, u.String(), maxSearchResponseSize)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, errors.New("timed out")
+		}
+		return nil, err
+	}
+	doc, err := decodeFeed(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	switch doc.XMLName.Local {
+	case "rss":
+	case "error":
+		return nil, fmt.Errorf("indexer error %s: %s", doc.Code, doc.Description)
+	default:
+		return nil, fmt.Errorf("invalid response: unexpected root element <%s>", doc.XMLName.Local)
+	}
+
+	results := make([]SearchResult, 0, len(doc.Channel.Items))
+	for _, it := range doc.Channel.Items {
+		item, ok := it.feedItem()
+		if !ok {
+			continue
+		}
+		result := SearchResult{
+			Title:     item.Title,
+			Source:    item.Source,
+			Size:      item.Size,
+			Published: item.Published,
+			Indexers:  []string{idx.Name},
+		}
+
+		attrs := make(map[string]string, len(it.Attrs))
+		for _, a := range it.Attrs {
+			attrs[a.Name] = a.Value
+		}
+		result.Seeders, _ = strconv.Atoi(attrs["seeders"])
+		// peers в Torznab — все пиры вместе с сидами
+		if peers, err := strconv.Atoi(attrs["peers"]); err == nil && peers >= result.Seeders {
+			result.Leechers = peers - result.Seeders
+		}
+		result.InfoHash = resultInfoHash(attrs["infohash"], item.Source)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// resultInfoHash возвращает info hash из атрибута индексатора или магнет-ссылки
+func resultInfoHash(attr, source string) string {
+	if attr = strings.ToLower(strings.TrimSpace(attr)); len(attr) == 40 {
+		return attr
+	}
+	if strings.HasPrefix(source, "magnet:") {
+		if m, err := metainfo.ParseMagnetUri(source); err == nil {
+			return m.InfoHash.HexString()
+		}
+	}
+	return ""
+}
+
+// mergeSearchResults объединяет результаты индексаторов по info hash, оставляя запись с большим числом сидов
+// и магнет-ссылку, если она есть хотя бы у одной из записей, и сортирует их по числу сидов
+func mergeSearchResults(perIndexer [][]SearchResult) []SearchResult {
+	merged := []SearchResult{}
+	byHash := make(map[string]int)
+	for _, results := range perIndexer {
+		for _, r := range results {
+			if r.InfoHash == "" {
+				merged = append(merged, r)
+				continue
+			}
+			i, ok := byHash[r.InfoHash]
+			if !ok {
+				byHash[r.InfoHash] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			indexers := merged[i].Indexers
+			if !slices.Contains(indexers, r.Indexers[0]) {
+				indexers = append(indexers, r.Indexers[0])
+			}
+			// Магнет-ссылка не требует загрузки .torrent файла, поэтому сохраняется при любом числе сидов
+			magnet := merged[i].Source
+			if strings.HasPrefix(r.Source, "magnet:") {
+				magnet = r.Source
+			}
+			if r.Seeders > merged[i].Seeders {
+				merged[i] = r
+			}
+			merged[i].Indexers = indexers
+			if strings.HasPrefix(magnet, "magnet:") {
+				merged[i].Source = magnet
+			}
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Seeders > merged[j].Seeders
+	})
+	return merged
+}
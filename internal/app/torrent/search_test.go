@@ -0,0 +1,267 @@
+package torrent
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testHashX = "0123456789abcdef0123456789abcdef01234567"
+	testHashY = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+// torznabItem возвращает запись ответа Torznab
+func torznabItem(title, link, infoHash string, seeders, peers int) string {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(link))
+	link = escaped.String()
+	return fmt.Sprintf(`<item>
+	<title>%s</title>
+	<link>%s</link>
+	<size>1000</size>
+	<torznab:attr name="seeders" value="%d"/>
+	<torznab:attr name="peers" value="%d"/>
+	<torznab:attr name="infohash" value="%s"/>
+</item>`, title, link, seeders, peers, infoHash)
+}
+
+// torznabFeed оборачивает записи в RSS документ Torznab
+func torznabFeed(items ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed"><channel>` +
+		strings.Join(items, "") + `</channel></rss>`
+}
+
+// newTorznabStub запускает индексатор и возвращает его адрес с apikey
+func newTorznabStub(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/api?apikey=secret"
+}
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+// hang не отвечает, пока клиент не отменит запрос
+func hang(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
+func TestSearchFansOutAndMerges(t *testing.T) {
+	magnetX := "magnet:?xt=urn:btih:" + testHashX + "&dn=X"
+
+	requests := make(chan url.Values, 1)
+	alpha := newTorznabStub(t, func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Query()
+		respond(torznabFeed(torznabItem("X", magnetX, "", 5, 8)))(w, r)
+	})
+	beta := newTorznabStub(t, respond(torznabFeed(
+		torznabItem("X", "http://tracker.example/x.torrent", strings.ToUpper(testHashX), 10, 12),
+		torznabItem("Y", "http://tracker.example/y.torrent", testHashY, 7, 7),
+	)))
+	slow := newTorznabStub(t, hang)
+	broken := newTorznabStub(t, respond(`<?xml version="1.0" encoding="UTF-8"?><error code="100" description="Invalid API Key"/>`))
+
+	searcher := NewSearcher([]Indexer{
+		{Name: "alpha", URL: alpha},
+		{Name: "beta", URL: beta},
+		{Name: "slow", URL: slow},
+		{Name: "broken", URL: broken},
+	}, 300*time.Millisecond)
+
+	started := time.Now()
+	response, err := searcher.Search(context.Background(), SearchQuery{Query: " dune ", Category: "2000"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Search() took %s, the slow indexer should have been cut off by its timeout", elapsed)
+	}
+
+	got := <-requests
+	if got.Get("t") != "search" || got.Get("q") != "dune" || got.Get("cat") != "2000" || got.Get("apikey") != "secret" {
+		t.Errorf("indexer got query %v, want t=search q=dune cat=2000 and the apikey", got)
+	}
+
+	if len(response.Results) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(response.Results), response.Results)
+	}
+	x := response.Results[0]
+	if x.InfoHash != testHashX || x.Seeders != 10 || x.Leechers != 2 {
+		t.Errorf("merged X = %+v, want the beta record with 10 seeders", x)
+	}
+	if x.Source != magnetX {
+		t.Errorf("merged X source = %q, want the magnet link from alpha", x.Source)
+	}
+	if !slices.Equal(x.Indexers, []string{"alpha", "beta"}) {
+		t.Errorf("merged X indexers = %v, want [alpha beta]", x.Indexers)
+	}
+	if y := response.Results[1]; y.InfoHash != testHashY || y.Source != "http://tracker.example/y.torrent" {
+		t.Errorf("Y = %+v", y)
+	}
+
+	errs := make(map[string]string)
+	for _, e := range response.Errors {
+		errs[e.Indexer] = e.Error
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v, want slow and broken", response.Errors)
+	}
+	if errs["slow"] != "timed out" {
+		t.Errorf("slow indexer error = %q, want timed out", errs["slow"])
+	}
+	if !strings.Contains(errs["broken"], "100") || !strings.Contains(errs["broken"], "Invalid API Key") {
+		t.Errorf("broken indexer error = %q, want the Torznab error code and description", errs["broken"])
+	}
+	for _, e := range response.Errors {
+		if strings.Contains(e.Error, "secret") {
+			t.Errorf("error of %s leaks the apikey: %q", e.Indexer, e.Error)
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	failing := newTorznabStub(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	})
+	torznabError := newTorznabStub(t, respond(`<error code="900" description="Search is disabled"/>`))
+	ok := newTorznabStub(t, respond(torznabFeed()))
+
+	tests := []struct {
+		name     string
+		indexers []Indexer
+		query    SearchQuery
+		want     error
+	}{
+		{
+			name:     "empty query",
+			indexers: []Indexer{{Name: "ok", URL: ok}},
+			query:    SearchQuery{Query: "  "},
+			want:     ErrInvalidSearch,
+		},
+		{
+			name:  "no indexers",
+			query: SearchQuery{Query: "dune"},
+			want:  ErrNoIndexers,
+		},
+		{
+			name:     "unknown indexer",
+			indexers: []Indexer{{Name: "ok", URL: ok}},
+			query:    SearchQuery{Query: "dune", Indexers: []string{"missing"}},
+			want:     ErrInvalidSearch,
+		},
+		{
+			name:     "all indexers failed",
+			indexers: []Indexer{{Name: "failing", URL: failing}, {Name: "torznab", URL: torznabError}},
+			query:    SearchQuery{Query: "dune"},
+			want:     ErrIndexersFailed,
+		},
+		{
+			name:     "only the selected indexer is queried",
+			indexers: []Indexer{{Name: "failing", URL: failing}, {Name: "ok", URL: ok}},
+			query:    SearchQuery{Query: "dune", Indexers: []string{"ok"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := NewSearcher(tt.indexers, time.Second)
+			response, err := searcher.Search(context.Background(), tt.query)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Search() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && len(response.Errors) != 0 {
+				t.Errorf("Search() errors = %v, want none", response.Errors)
+			}
+		})
+	}
+}
+
+func TestMergeSearchResults(t *testing.T) {
+	magnet := "magnet:?xt=urn:btih:" + testHashX
+
+	tests := []struct {
+		name       string
+		perIndexer [][]SearchResult
+		want       []SearchResult
+	}{
+		{
+			name: "same hash is merged and keeps the magnet of the weaker record",
+			perIndexer: [][]SearchResult{
+				{{Title: "X", InfoHash: testHashX, Source: magnet, Seeders: 1, Indexers: []string{"a"}}},
+				{{Title: "X (b)", InfoHash: testHashX, Source: "http://b/x.torrent", Seeders: 9, Indexers: []string{"b"}}},
+			},
+			want: []SearchResult{
+				{Title: "X (b)", InfoHash: testHashX, Source: magnet, Seeders: 9, Indexers: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "magnet of a weaker record replaces the .torrent link",
+			perIndexer: [][]SearchResult{
+				{{Title: "X", InfoHash: testHashX, Source: "http://a/x.torrent", Seeders: 9, Indexers: []string{"a"}}},
+				{{Title: "X", InfoHash: testHashX, Source: magnet, Seeders: 1, Indexers: []string{"b"}}},
+			},
+			want: []SearchResult{
+				{Title: "X", InfoHash: testHashX, Source: magnet, Seeders: 9, Indexers: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "results without a hash are never merged",
+			perIndexer: [][]SearchResult{
+				{{Title: "Z", Source: "http://a/z.torrent", Seeders: 1, Indexers: []string{"a"}}},
+				{{Title: "Z", Source: "http://b/z.torrent", Seeders: 2, Indexers: []string{"b"}}},
+			},
+			want: []SearchResult{
+				{Title: "Z", Source: "http://b/z.torrent", Seeders: 2, Indexers: []string{"b"}},
+				{Title: "Z", Source: "http://a/z.torrent", Seeders: 1, Indexers: []string{"a"}},
+			},
+		},
+		{
+			name: "sorted by seeders",
+			perIndexer: [][]SearchResult{
+				{
+					{Title: "X", InfoHash: testHashX, Source: magnet, Seeders: 3, Indexers: []string{"a"}},
+					{Title: "Y", InfoHash: testHashY, Source: "http://a/y.torrent", Seeders: 30, Indexers: []string{"a"}},
+				},
+			},
+			want: []SearchResult{
+				{Title: "Y", InfoHash: testHashY, Source: "http://a/y.torrent", Seeders: 30, Indexers: []string{"a"}},
+				{Title: "X", InfoHash: testHashX, Source: magnet, Seeders: 3, Indexers: []string{"a"}},
+			},
+		},
+		{
+			name: "no results",
+			want: []SearchResult{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeSearchResults(tt.perIndexer)
+			if len(got) != len(tt.want) {
+				t.Fatalf("mergeSearchResults() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.Title != w.Title || g.InfoHash != w.InfoHash || g.Source != w.Source ||
+					g.Seeders != w.Seeders || !slices.Equal(g.Indexers, w.Indexers) {
+					t.Errorf("result %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
@@ -3,28 +3,544 @@ package torrent
 import (
 	"GoFlix/internal/app/media"
 	"GoFlix/internal/pkg/filehelpers"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 // Service handles the business logic for managing torrents.
 type Service struct {
 	client       *Client
 	stateManager *StateManager
+
+	// Ожидание метаданных магнет-ссылок
+	metadataTimeout time.Duration
+	pendingMetadata map[string]context.CancelFunc
+	pendingMu       sync.Mutex
+
+	// Предпросмотры торрентов, которые ещё не подтвердили
+	previews  map[string]*torrentPreview
+	previewMu sync.Mutex
+
+	// Очередь загрузки
+	queueLimits QueueLimits
+	queueKick   chan struct{}
+	queueMu     sync.Mutex
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService creates a new torrent service and starts its download queue.
+// metadataTimeout limits how long a magnet link may wait for its metadata, zero means no limit.
+func NewService(client *Client, stateManager *StateManager, metadataTimeout time.Duration, queueLimits QueueLimits) *Service {
+	s := &Service{
+		client:          client,
+		stateManager:    stateManager,
+		metadataTimeout: metadataTimeout,
+		pendingMetadata: make(map[string]context.CancelFunc),
+		previews:        make(map[string]*torrentPreview),
+		queueLimits:     queueLimits,
+		queueKick:       make(chan struct{}, 1),
+		stopChan:        make(chan struct{}),
+	}
+	go s.runQueue()
+	go s.runPreviewCleanup()
+
+	return s
+}
+
+// AddTorrent adds a new torrent from a magnet link, file path or http(s) .torrent URL.
+// It does not block: metadata of magnet links is fetched in the background.
+func (s *Service) AddTorrent(source string, opts AddOptions) (string, error) {
+	return s.AddTorrentContext(context.Background(), source, opts)
+}
+
+// AddTorrentContext is like AddTorrent, ctx bounds the download of an http(s) .torrent URL.
+func (s *Service) AddTorrentContext(ctx context.Context, source string, opts AddOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	if isHTTPSource(source) {
+		return s.addFromURL(ctx, source, opts)
+	}
+	savePath, err := s.client.ResolveSavePath(opts.SavePath)
+	if err != nil {
+		return "", err
+	}
+	opts.SavePath = savePath
+
+	infoHash, err := s.client.Add(source, savePath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.trackAddedTorrent(infoHash, source, opts); err != nil {
+		return "", err
+	}
+	return infoHash, nil
+}
+
+// AddTorrentFile adds a new torrent from the contents of a .torrent file.
+func (s *Service) AddTorrentFile(r io.Reader, opts AddOptions) (*AddedTorrent, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	mi, err := LoadTorrentFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.addTorrentMetaInfo(mi, opts)
+}
+
+// addTorrentMetaInfo adds a torrent from parsed metainfo and returns its files.
+func (s *Service) addTorrentMetaInfo(mi *metainfo.MetaInfo, opts AddOptions) (*AddedTorrent, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	savePath, err := s.client.ResolveSavePath(opts.SavePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.SavePath = savePath
+
+	infoHash, err := s.addMetaInfo(mi, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.client.GetFiles(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	return &AddedTorrent{
+		InfoHash: infoHash,
+		Name:     s.client.DisplayName(infoHash),
+		Files:    files,
+	}, nil
+}
+
+// addMetaInfo adds a torrent from parsed metainfo with already validated options.
+func (s *Service) addMetaInfo(mi *metainfo.MetaInfo, opts AddOptions) (string, error) {
+	infoHash, err := s.client.AddMetaInfo(mi, opts.SavePath)
+	if err != nil {
+		return "", err
+	}
+	if err := s.trackAddedTorrent(infoHash, "", opts); err != nil {
+		return "", err
+	}
+	return infoHash, nil
 }
 
-// NewService creates a new torrent service.
-func NewService(client *Client, stateManager *StateManager) *Service {
-	return &Service{
-		client:       client,
-		stateManager: stateManager,
+// CreateTorrent builds a torrent from a file or folder of the library and starts seeding it in place.
+// Conversion is turned off for the new torrent, since its videos are already in the library.
+func (s *Service) CreateTorrent(opts CreateOptions) (*CreatedTorrent, error) {
+	mi, savePath, err := s.client.BuildMetaInfo(opts)
+	if err != nil {
+		return nil, err
+	}
+	infoHash := mi.HashInfoBytes().HexString()
+
+	// Сохраняем исходный .torrent, чтобы отдавать его с комментарием и автором
+	if err := s.stateManager.SaveMetaInfo(infoHash, mi); err != nil {
+		log.Printf("[service] Failed to save metainfo of %s: %v", infoHash, err)
+	}
+	autoConvert := false
+	if _, err := s.addMetaInfo(mi, AddOptions{SavePath: savePath, AutoConvert: &autoConvert}); err != nil {
+		return nil, err
+	}
+
+	magnet, err := mi.MagnetV2()
+	if err != nil {
+		return nil, err
 	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[service] Created torrent %s (%s) from %s", info.BestName(), infoHash, opts.Path)
+
+	return &CreatedTorrent{
+		InfoHash:    infoHash,
+		Name:        info.BestName(),
+		Magnet:      magnet.String(),
+		MetaInfoURL: "/api/torrents/" + infoHash + "/metainfo",
+	}, nil
 }
 
-// AddTorrent adds a new torrent from a magnet link or file path.
-func (s *Service) AddTorrent(magnet string) (string, error) {
-	return s.client.Add(magnet)
+// RestoreTorrent adds a torrent from the state back to the client.
+// Saved metainfo is preferred over the magnet link, so the torrent does not wait for metadata from peers.
+func (s *Service) RestoreTorrent(t *Torrent) error {
+	opts := AddOptions{SavePath: t.SavePath}
+
+	mi, err := s.stateManager.LoadMetaInfo(t.InfoHash)
+	if err == nil {
+		if opts.SavePath, err = s.client.ResolveSavePath(opts.SavePath); err != nil {
+			return err
+		}
+		_, err = s.addMetaInfo(mi, opts)
+		return err
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[service] Failed to load metainfo of %s, falling back to magnet: %v", t.InfoHash, err)
+	}
+
+	_, err = s.AddTorrent(t.Magnet, opts)
+	return err
+}
+
+// saveMetaInfo stores the metainfo of a torrent with known metadata next to the state.
+func (s *Service) saveMetaInfo(infoHash string) {
+	mi, err := s.client.MetaInfo(infoHash)
+	if err == nil {
+		err = s.stateManager.SaveMetaInfo(infoHash, mi)
+	}
+	if err != nil {
+		log.Printf("[service] Failed to save metainfo of %s: %v", infoHash, err)
+	}
+}
+
+// GetMetaInfo returns the metainfo of a torrent, from the client or from the saved .torrent file.
+func (s *Service) GetMetaInfo(infoHash string) (*metainfo.MetaInfo, error) {
+	if s.client.HasInfo(infoHash) {
+		return s.client.MetaInfo(infoHash)
+	}
+	if _, err := s.stateManager.GetTorrent(infoHash); err != nil {
+		return nil, err
+	}
+	return s.stateManager.LoadMetaInfo(infoHash)
+}
+
+// trackAddedTorrent stores a freshly added torrent in the state and starts its download,
+// or waits for its metadata in the background if it is not known yet.
+// Options are saved together with the torrent, and a new torrent is dropped from the client if they can't be applied.
+func (s *Service) trackAddedTorrent(infoHash, source string, opts AddOptions) error {
+	stored, err := s.stateManager.GetTorrent(infoHash)
+	known := err == nil
+	// Торрент ставится на паузу до начала загрузки; приостановленный остаётся на паузе и после перезапуска
+	if opts.Paused || (known && stored.State == StatePaused) {
+		if err := s.client.PauseTorrent(infoHash); err != nil {
+			return err
+		}
+	}
+
+	s.applyStoredTrackers(infoHash)
+
+	if s.client.HasInfo(infoHash) {
+		if err := s.checkFilePaths(infoHash, opts.FilePriorities); err != nil {
+			if !known {
+				if dropErr := s.client.DeleteTorrent(infoHash); dropErr != nil {
+					log.Printf("[service] error dropping torrent from client: %v", dropErr)
+				}
+			}
+			return err
+		}
+
+		active, err := s.client.GetTorrent(infoHash)
+		if err != nil {
+			return err
+		}
+		s.stateManager.AddTorrentWithOptions(active, opts)
+		s.saveMetaInfo(infoHash)
+		return s.startDownload(infoHash)
+	}
+
+	s.pendingMu.Lock()
+	if _, pending := s.pendingMetadata[infoHash]; pending {
+		s.pendingMu.Unlock()
+		return nil
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.metadataTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), s.metadataTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	s.pendingMetadata[infoHash] = cancel
+	s.pendingMu.Unlock()
+
+	s.stateManager.MarkAsFetchingMetadata(&Torrent{
+		InfoHash:        infoHash,
+		Name:            s.client.DisplayName(infoHash),
+		Magnet:          source,
+		ConvertingState: StateNotConverted,
+	}, opts)
+
+	go s.fetchMetadata(ctx, infoHash)
+
+	return nil
+}
+
+// applyStoredTrackers applies the trackers the user added or removed to a torrent re-added to the client.
+func (s *Service) applyStoredTrackers(infoHash string) {
+	stored, err := s.stateManager.GetTorrent(infoHash)
+	if err != nil || (len(stored.AddedTrackers) == 0 && len(stored.RemovedTrackers) == 0) {
+		return
+	}
+	if err := s.client.EditTrackers(infoHash, stored.AddedTrackers, stored.RemovedTrackers); err != nil {
+		log.Printf("[service] Failed to apply trackers of %s: %v", infoHash, err)
+	}
+}
+
+// GetTrackers returns the trackers of a torrent with their announce status.
+// For a torrent that is not loaded in the client only the trackers added by the user are known.
+func (s *Service) GetTrackers(infoHash string) ([]TrackerStatus, error) {
+	if s.client.HasTorrent(infoHash) {
+		return s.client.Trackers(infoHash)
+	}
+
+	stored, err := s.stateManager.GetTorrent(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]TrackerStatus, 0, len(stored.AddedTrackers))
+	for _, u := range stored.AddedTrackers {
+		statuses = append(statuses, TrackerStatus{URL: u, Status: TrackerNotContacted})
+	}
+	return statuses, nil
+}
+
+// AddTrackers adds trackers to a torrent and saves them in the state.
+func (s *Service) AddTrackers(infoHash string, urls []string) ([]TrackerStatus, error) {
+	return s.editTrackers(infoHash, urls, nil)
+}
+
+// RemoveTrackers removes trackers from a torrent and remembers them as removed in the state.
+func (s *Service) RemoveTrackers(infoHash string, urls []string) ([]TrackerStatus, error) {
+	return s.editTrackers(infoHash, nil, urls)
+}
+
+func (s *Service) editTrackers(infoHash string, add, remove []string) ([]TrackerStatus, error) {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, fmt.Errorf("no trackers given: %w", ErrInvalidTrackerURL)
+	}
+	for _, u := range add {
+		if err := ValidateTrackerURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.stateManager.EditTrackers(infoHash, add, remove); err != nil {
+		return nil, err
+	}
+	// Торрент, которого нет в клиенте, получит трекеры при повторном добавлении
+	if s.client.HasTorrent(infoHash) {
+		if err := s.client.EditTrackers(infoHash, add, remove); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[service] Trackers of %s edited: added %v, removed %v", infoHash, add, remove)
+	return s.GetTrackers(infoHash)
+}
+
+// Reannounce announces a torrent to all of its trackers right away.
+func (s *Service) Reannounce(infoHash string) error {
+	return s.client.Reannounce(infoHash)
+}
+
+// startDownload applies the stored file priorities, download mode, rate limits and queue limits to a torrent with known metadata.
+func (s *Service) startDownload(infoHash string) error {
+	// Торрент ждёт в очереди, пока не станет известно, что загружать: очередь
+	// различает загрузки и раздачи по выбранным файлам
+	s.client.SetQueued(infoHash, true)
+	defer s.applyQueue()
+
+	var priorities map[string]FilePriority
+	var limits RateLimits
+	var mode DownloadMode
+	if t, err := s.stateManager.GetTorrent(infoHash); err == nil {
+		priorities = t.FilePriorities
+		limits = t.Limits
+		mode = t.DownloadMode
+	}
+	if err := s.client.SetTorrentLimits(infoHash, limits); err != nil {
+		return err
+	}
+	if err := s.client.ApplyFilePriorities(infoHash, priorities); err != nil {
+		return err
+	}
+	return s.client.SetDownloadMode(infoHash, mode)
+}
+
+// checkFilePaths verifies that every path refers to a file of the torrent.
+func (s *Service) checkFilePaths(infoHash string, priorities map[string]FilePriority) error {
+	if len(priorities) == 0 {
+		return nil
+	}
+
+	files, err := s.client.GetFiles(infoHash)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		known[f.Path] = struct{}{}
+	}
+	for path := range priorities {
+		if _, ok := known[path]; !ok {
+			return fmt.Errorf("file %s not found in torrent %s: %w", path, infoHash, ErrFileNotFound)
+		}
+	}
+	return nil
+}
+
+// GetTorrentFiles returns the files of an active torrent with their priorities.
+func (s *Service) GetTorrentFiles(infoHash string) ([]TorrentFile, error) {
+	return s.client.GetFiles(infoHash)
+}
+
+// GetPieceMap returns the piece states and their availability in the swarm for an active torrent.
+func (s *Service) GetPieceMap(infoHash string) (PieceMap, error) {
+	return s.client.PieceMap(infoHash)
+}
+
+// WatchPieces returns the piece map of an active torrent and streams piece state changes after it until ctx is done.
+func (s *Service) WatchPieces(ctx context.Context, infoHash string) (PieceMap, <-chan PieceChange, error) {
+	return s.client.WatchPieces(ctx, infoHash)
+}
+
+// OpenTorrentFile opens a file of an active torrent for streaming while it is downloading.
+func (s *Service) OpenTorrentFile(ctx context.Context, infoHash string, path string) (*FileStream, error) {
+	return s.client.OpenFile(ctx, infoHash, path)
+}
+
+// SetFilePriorities changes the priorities of files inside a torrent and saves them in the state.
+func (s *Service) SetFilePriorities(infoHash string, priorities map[string]FilePriority) error {
+	if err := validateFilePriorities(priorities); err != nil {
+		return err
+	}
+
+	activeWithInfo := s.client.HasInfo(infoHash)
+	if activeWithInfo {
+		if err := s.checkFilePaths(infoHash, priorities); err != nil {
+			return err
+		}
+	}
+
+	if err := s.stateManager.SetFilePriorities(infoHash, priorities); err != nil {
+		return err
+	}
+
+	if activeWithInfo {
+		return s.startDownload(infoHash)
+	}
+	return nil
+}
+
+// SetDownloadMode changes the piece order of a torrent and saves it in the state.
+func (s *Service) SetDownloadMode(infoHash string, mode DownloadMode) error {
+	if err := s.stateManager.SetDownloadMode(infoHash, mode); err != nil {
+		return err
+	}
+	if !s.client.HasInfo(infoHash) {
+		// Режим применится в startDownload, когда станут известны метаданные
+		return nil
+	}
+	return s.client.SetDownloadMode(infoHash, mode)
+}
+
+// ClientSettings returns the network settings the torrent client runs with.
+func (s *Service) ClientSettings() ClientSettings {
+	return s.client.NetworkSettings()
+}
+
+// BlocklistStatus returns the state of the IP blocklist.
+func (s *Service) BlocklistStatus() (BlocklistStatus, error) {
+	return s.client.BlocklistStatus()
+}
+
+// ReloadBlocklist reads the IP blocklist file again and returns its new state.
+func (s *Service) ReloadBlocklist() (BlocklistStatus, error) {
+	if err := s.client.ReloadBlocklist(); err != nil {
+		return BlocklistStatus{}, err
+	}
+	log.Printf("[service] Blocklist reloaded")
+	return s.client.BlocklistStatus()
+}
+
+// GlobalLimits returns the client-wide rate limits.
+func (s *Service) GlobalLimits() RateLimits {
+	return s.client.GlobalLimits()
+}
+
+// SetGlobalLimits changes the client-wide rate limits until the next restart.
+func (s *Service) SetGlobalLimits(limits RateLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	s.client.SetGlobalLimits(limits)
+	return nil
+}
+
+// SetTorrentLimits changes the rate limits of a single torrent and saves them in the state.
+func (s *Service) SetTorrentLimits(infoHash string, limits RateLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	if err := s.stateManager.SetLimits(infoHash, limits); err != nil {
+		return err
+	}
+	if err := s.client.SetTorrentLimits(infoHash, limits); err != nil {
+		// Торрент не загружен в клиент, ограничения применятся при следующем добавлении
+		log.Printf("[service] limits saved but not applied: %v", err)
+	}
+	return nil
+}
+
+// fetchMetadata waits for the torrent metadata and starts the download once it arrives.
+func (s *Service) fetchMetadata(ctx context.Context, infoHash string) {
+	defer s.cancelMetadataFetch(infoHash)
+
+	if err := s.client.WaitForInfo(ctx, infoHash); err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			log.Printf("[service] metadata fetch timed out for %s", infoHash)
+			if dropErr := s.client.DeleteTorrent(infoHash); dropErr != nil {
+				log.Printf("[service] error dropping torrent from client: %v", dropErr)
+			}
+			if markErr := s.stateManager.MarkMetadataFailed(infoHash, "metadata fetch timed out"); markErr != nil {
+				log.Printf("[service] failed to mark metadata failure: %v", markErr)
+			}
+		case errors.Is(err, context.Canceled):
+			log.Printf("[service] metadata fetch cancelled for %s", infoHash)
+		default:
+			log.Printf("[service] metadata fetch stopped for %s: %v", infoHash, err)
+		}
+		return
+	}
+
+	s.saveMetaInfo(infoHash)
+	if err := s.startDownload(infoHash); err != nil {
+		log.Printf("[service] failed to start download for %s: %v", infoHash, err)
+		return
+	}
+
+	active, err := s.client.GetTorrent(infoHash)
+	if err != nil {
+		log.Printf("[service] failed to get torrent %s after metadata: %v", infoHash, err)
+		return
+	}
+	s.stateManager.MarkMetadataReceived(active)
+}
+
+// cancelMetadataFetch stops waiting for the torrent metadata, if it is still pending.
+func (s *Service) cancelMetadataFetch(infoHash string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if cancel, ok := s.pendingMetadata[infoHash]; ok {
+		cancel()
+		delete(s.pendingMetadata, infoHash)
+	}
 }
 
 // GetTorrents returns a list of all torrents (active and inactive).
@@ -33,14 +549,19 @@ func (s *Service) GetTorrents() []Torrent {
 	// Use a map to merge active torrents with stored states
 	torrentsMap := s.stateManager.GetAllTorrents()
 
+	// Статистика и действующие ограничения не сохраняются в состояние и добавляются только в ответ
+	stats := make(map[string]*TransferStats, len(activeTorrents))
+	effective := make(map[string]*RateLimits, len(activeTorrents))
+
 	for _, t := range activeTorrents {
+		stats[t.InfoHash] = t.Stats
+		effective[t.InfoHash] = t.EffectiveLimits
+		t.Stats = nil
+		t.EffectiveLimits = nil
+
 		if existing, ok := torrentsMap[t.InfoHash]; ok {
 			// Обновляем поля, если они отличаются
-			if existing.DownloadedPercent != t.DownloadedPercent || existing.Done != t.Done ||
-				existing.State != t.State {
-				existing.DownloadedPercent = t.DownloadedPercent
-				existing.Done = t.Done
-				existing.State = t.State
+			if mergeActiveTorrent(existing, &t) {
 				s.stateManager.UpdateTorrent(existing)
 			}
 			torrentsMap[t.InfoHash] = existing
@@ -58,12 +579,29 @@ func (s *Service) GetTorrents() []Torrent {
 			s.updateTorrentVideoFiles(t)
 			s.stateManager.UpdateTorrent(t)
 		}
-		torrents = append(torrents, *t)
+		result := *t
+		result.Stats = stats[t.InfoHash]
+		result.EffectiveLimits = effective[t.InfoHash]
+		torrents = append(torrents, result)
 	}
 
 	return torrents
 }
 
+// mergeActiveTorrent copies the live fields of an active torrent into the stored one
+// and reports whether any of them changed.
+func mergeActiveTorrent(stored, active *Torrent) bool {
+	changed := stored.DownloadedPercent != active.DownloadedPercent || stored.Done != active.Done ||
+		stored.State != active.State || stored.SelectedSize != active.SelectedSize
+
+	stored.DownloadedPercent = active.DownloadedPercent
+	stored.SelectedSize = active.SelectedSize
+	stored.Done = active.Done
+	stored.State = active.State
+
+	return changed
+}
+
 // GetTorrent returns a single torrent by its info hash.
 func (s *Service) GetTorrent(infoHash string) (*Torrent, error) {
 	// First, check the state manager
@@ -72,11 +610,8 @@ func (s *Service) GetTorrent(infoHash string) (*Torrent, error) {
 	if err == nil {
 		// If it's also active in the client, update its status
 		activeTorrent, errGetActiveTorrent := s.client.GetTorrent(infoHash)
-		changed := activeTorrent != nil && (t.DownloadedPercent != activeTorrent.DownloadedPercent || t.Done != activeTorrent.Done || t.State != activeTorrent.State)
-		if errGetActiveTorrent == nil && changed {
-			t.DownloadedPercent = activeTorrent.DownloadedPercent
-			t.Done = activeTorrent.Done
-			t.State = activeTorrent.State
+		if errGetActiveTorrent == nil && activeTorrent != nil {
+			mergeActiveTorrent(t, activeTorrent)
 		}
 
 		// обновление информации о видео файлах
@@ -84,7 +619,13 @@ func (s *Service) GetTorrent(infoHash string) (*Torrent, error) {
 		// update torrent in stateManager
 		s.stateManager.UpdateTorrent(t)
 
-		return t, nil
+		// Статистика и действующие ограничения не сохраняются в состояние и добавляются только в ответ
+		result := *t
+		if activeTorrent != nil {
+			result.Stats = activeTorrent.Stats
+			result.EffectiveLimits = activeTorrent.EffectiveLimits
+		}
+		return &result, nil
 	}
 
 	// If not in state, check the client directly
@@ -95,8 +636,11 @@ func (s *Service) GetTorrent(infoHash string) (*Torrent, error) {
 
 	// обновление информации о видео файлах
 	s.updateTorrentVideoFiles(torrent) // Ensure we update info for the found torrent
-	// update torrent in stateManager
-	s.stateManager.UpdateTorrent(torrent)
+	// В состояние уходит копия, чтобы статистика осталась в ответе
+	stored := *torrent
+	stored.Stats = nil
+	stored.EffectiveLimits = nil
+	s.stateManager.UpdateTorrent(&stored)
 
 	return torrent, nil
 }
@@ -106,31 +650,182 @@ func (s *Service) PauseTorrent(infoHash string) error {
 	if err := s.client.PauseTorrent(infoHash); err != nil {
 		return err
 	}
+	s.kickQueue()
 	return s.stateManager.MarkAsPaused(infoHash)
 }
 
 // ResumeTorrent resumes a torrent.
+// A paused torrent is resumed in place, a torrent missing from the client is added again.
 func (s *Service) ResumeTorrent(infoHash string) error {
 	torrent, err := s.stateManager.GetTorrent(infoHash)
 	if err != nil {
 		return fmt.Errorf("torrent with infohash %s not found", infoHash)
 	}
 
-	if _, err := s.client.Add(torrent.Magnet); err != nil {
+	if err := s.stateManager.MarkAsResumed(infoHash); err != nil {
+		return err
+	}
+
+	if s.client.HasTorrent(infoHash) {
+		if err := s.client.ResumeTorrent(infoHash); err != nil {
+			return err
+		}
+		s.kickQueue()
+		if !s.client.HasInfo(infoHash) {
+			// Метаданные ещё загружаются
+			s.stateManager.MarkAsFetchingMetadata(torrent, AddOptions{})
+		}
+		return nil
+	}
+
+	if err := s.RestoreTorrent(torrent); err != nil {
 		return fmt.Errorf("[service] failed to resume torrent: %v", err)
 	}
-	return s.stateManager.MarkAsResumed(infoHash)
+	return nil
+}
+
+// sendRecheckEvent отправляет событие проверки с сохранённым торрентом и его текущей статистикой
+func (s *Service) sendRecheckEvent(eventType, infoHash string) {
+	torrent, err := s.stateManager.GetTorrent(infoHash)
+	if err != nil {
+		return
+	}
+	if active, err := s.client.GetTorrent(infoHash); err == nil && active != nil {
+		torrent.Stats = active.Stats
+	}
+	s.stateManager.SendEvent(Event{
+		Type:      eventType,
+		Torrent:   torrent,
+		Timestamp: time.Now(),
+	})
 }
 
-// DeleteTorrent deletes a torrent.
-func (s *Service) DeleteTorrent(infoHash string) error {
+// RecheckTorrent starts re-hashing the data of a torrent. Its progress is reported in the torrent stats.
+// Pieces that fail the check are downloaded again.
+func (s *Service) RecheckTorrent(infoHash string) error {
+	results, err := s.client.StartRecheck(infoHash)
+	if err != nil {
+		return err
+	}
+	log.Printf("[service] Rechecking torrent %s", infoHash)
+
+	go func() {
+		// Ход проверки рассылается раз в секунду, он же виден в stats.recheck торрента
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		var result RecheckResult
+	wait:
+		for {
+			select {
+			case result = <-results:
+				break wait
+			case <-ticker.C:
+				s.sendRecheckEvent("recheck_progress", infoHash)
+			}
+		}
+		if result.Err != nil {
+			log.Printf("[service] Recheck of %s failed: %v", infoHash, result.Err)
+			return
+		}
+		log.Printf("[service] Recheck of %s finished: %d/%d pieces valid, %d invalidated",
+			infoHash, result.ValidPieces, result.TotalPieces, result.InvalidatedPieces)
+
+		// Сохраняем исправленный прогресс: торрент с повреждёнными данными снова загружается
+		if _, err := s.GetTorrent(infoHash); err != nil {
+			log.Printf("[service] Failed to update torrent %s after recheck: %v", infoHash, err)
+		}
+		s.sendRecheckEvent("recheck_completed", infoHash)
+		s.kickQueue()
+	}()
+
+	return nil
+}
+
+// MoveStorage moves the data and HLS output of a torrent to savePath in the background.
+// The torrent keeps seeding while its files are copied and is restarted from the new location afterwards.
+func (s *Service) MoveStorage(infoHash string, savePath string) error {
+	stored, err := s.stateManager.GetTorrent(infoHash)
+	if err != nil {
+		return err
+	}
+	target, err := s.client.ResolveSavePath(savePath)
+	if err != nil {
+		return err
+	}
+
+	done, err := s.client.StartMoveStorage(infoHash, target, stored)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := <-done; err != nil {
+			log.Printf("[service] Failed to move torrent %s: %v", infoHash, err)
+			if errors.Is(err, errMoveReverted) {
+				if err := s.trackAddedTorrent(infoHash, stored.Magnet, AddOptions{}); err != nil {
+					log.Printf("[service] Failed to restart torrent %s after failed move: %v", infoHash, err)
+				}
+			}
+			return
+		}
+		if err := s.stateManager.SetSavePath(infoHash, target); err != nil {
+			log.Printf("[service] Failed to save new location of torrent %s: %v", infoHash, err)
+			return
+		}
+		// Торрент добавлен в клиент заново, его настройки применяются повторно
+		if err := s.trackAddedTorrent(infoHash, stored.Magnet, AddOptions{}); err != nil {
+			log.Printf("[service] Failed to restart torrent %s after move: %v", infoHash, err)
+			return
+		}
+		log.Printf("[service] Torrent %s moved to %s", infoHash, savePath)
+	}()
+
+	return nil
+}
+
+// DeleteTorrent deletes a torrent and, depending on opts, its files, HLS output and piece completion.
+// Nothing is deleted if any of the paths lies outside the torrents directory.
+func (s *Service) DeleteTorrent(infoHash string, opts DeleteOptions) (*DeleteResult, error) {
+	s.cancelMetadataFetch(infoHash)
+
+	// Пути собираются до удаления торрента из клиента, пока известны его метаданные
+	var plan *deletePlan
+	if opts.Data || opts.HLS || opts.PieceCompletion {
+		stored, _ := s.stateManager.GetTorrent(infoHash)
+		var err error
+		plan, err = s.client.planDeletion(infoHash, stored)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := s.client.DeleteTorrent(infoHash); err != nil {
 		// Log error but continue to remove from state
 		log.Printf("[service] error dropping torrent from client: %v", err)
 	}
-
 	s.stateManager.RemoveTorrent(infoHash)
-	return nil
+	s.kickQueue()
+
+	result := &DeleteResult{}
+	if plan == nil {
+		return result, nil
+	}
+
+	var errs []error
+	if opts.PieceCompletion && plan.numPieces > 0 {
+		reset, err := s.client.resetPieceCompletion(infoHash, plan.numPieces)
+		result.PiecesReset = reset
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reset piece completion: %w", err))
+		}
+	}
+	if err := plan.execute(opts, result); err != nil {
+		errs = append(errs, err)
+	}
+
+	log.Printf("[service] deleted torrent %s, freed %d bytes in %d files", infoHash, result.FreedBytes, result.RemovedFiles)
+	return result, errors.Join(errs...)
 }
 
 // ConvertTorrent adds a torrent to the conversion queue.
@@ -171,7 +866,14 @@ func (s *Service) ConvertTorrentToHls(t *Torrent) error {
 			if err != nil {
 				return err
 			}
-			err = media.ConvertToHls(abs)
+			switch t.ConversionProfile {
+			case ConversionCopy:
+				err = media.CopyToHls(abs)
+			case ConversionAdaptive:
+				err = media.ConvertToHlsWithAdaptiveBitrateSingle(abs)
+			default:
+				err = media.ConvertToHls(abs)
+			}
 			if err != nil {
 				return err
 			}
@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +20,8 @@ type StateManager struct {
 	states       map[string]*Torrent
 	stateFile    string
 	eventChannel chan Event
+	// metainfoDir хранит .torrent файлы торрентов рядом с файлом состояния
+	metainfoDir string
 
 	// Каналы для фоновых операций
 	saveChannel  chan struct{}
@@ -37,6 +43,7 @@ func NewTorrentStateManager(stateFile string) *StateManager {
 	sm := &StateManager{
 		states:          make(map[string]*Torrent),
 		stateFile:       stateFile,
+		metainfoDir:     filepath.Join(filepath.Dir(stateFile), metainfoDirName),
 		eventChannel:    make(chan Event, 1000),
 		saveChannel:     make(chan struct{}, 1),
 		batchUpdates:    make(chan *Torrent, 1000),
@@ -75,6 +82,9 @@ func (sm *StateManager) loadStates() error {
 
 	log.Printf("Loaded %d torrent states from file", len(sm.states))
 
+	// Торренты из старых файлов состояния ставятся в конец очереди
+	sm.assignMissingQueuePositions()
+
 	// Отправляем события для всех загруженных торрентов
 	sm.sendLoadedTorrentEvents()
 
@@ -182,11 +192,30 @@ func (sm *StateManager) updateTorrentState(torrent *Torrent) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	sm.storeTorrent(torrent)
+}
+
+// storeTorrent записывает торрент в состояние, вызывается под sm.mu
+func (sm *StateManager) storeTorrent(torrent *Torrent) {
 	oldTorrent, exists := sm.states[torrent.InfoHash]
+	// Статистика обмена и действующие ограничения относятся к текущей сессии и не сохраняются
+	torrent.Stats = nil
+	torrent.EffectiveLimits = nil
+
+	// Место в очереди меняется только через MoveInQueue и SetForceStart,
+	// поэтому устаревшая копия торрента не должна его перезаписывать
+	if exists {
+		torrent.QueuePosition = oldTorrent.QueuePosition
+		torrent.ForceStart = oldTorrent.ForceStart
+	} else if torrent.QueuePosition == 0 {
+		torrent.QueuePosition = sm.nextQueuePosition()
+	}
 
 	// if torrent not downloaded drop all states
 	if !torrent.Done {
-		torrent.State = StateDownloading
+		if torrent.State == StateCompleted {
+			torrent.State = StateDownloading
+		}
 		torrent.CompletedAt = nil
 		torrent.ConvertingQueuedAt = nil
 		torrent.ConvertedAt = nil
@@ -194,7 +223,10 @@ func (sm *StateManager) updateTorrentState(torrent *Torrent) {
 
 	// Проверяем, если торрент только что завершился или его нет в списке и он завершился
 	if (oldTorrent != nil && !oldTorrent.Done && torrent.Done) || (!exists && torrent.Done) {
-		torrent.State = StateCompleted
+		// Пауза, поставленная пользователем, остаётся и после завершения
+		if torrent.State != StatePaused {
+			torrent.State = StateCompleted
+		}
 		now := time.Now()
 		torrent.CompletedAt = &now
 
@@ -265,12 +297,366 @@ func (sm *StateManager) UpdateTorrent(torrent *Torrent) {
 	}
 }
 
+// AddTorrent синхронно добавляет торрент в состояние, если его там ещё нет
+func (sm *StateManager) AddTorrent(torrent *Torrent) {
+	sm.mu.RLock()
+	_, exists := sm.states[torrent.InfoHash]
+	sm.mu.RUnlock()
+
+	if exists {
+		return
+	}
+
+	torrent.LastChecked = time.Now()
+	sm.updateTorrentState(torrent)
+}
+
+// AddTorrentWithOptions добавляет торрент в состояние вместе с параметрами добавления.
+// Если торрент уже есть, параметры применяются к сохранённой записи, а незаданные сохраняют прежние значения.
+func (sm *StateManager) AddTorrentWithOptions(torrent *Torrent, opts AddOptions) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	if existing, exists := sm.states[torrent.InfoHash]; exists {
+		existing.applyAddOptions(opts)
+		existing.LastChecked = now
+
+		// Сохраняем состояние
+		select {
+		case sm.saveChannel <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	torrent.applyAddOptions(opts)
+	torrent.LastChecked = now
+	sm.storeTorrent(torrent)
+}
+
+// applyAddOptions переносит параметры добавления в запись торрента
+func (t *Torrent) applyAddOptions(opts AddOptions) {
+	if len(opts.FilePriorities) > 0 {
+		t.FilePriorities = mergeFilePriorities(t.FilePriorities, opts.FilePriorities)
+	}
+	if opts.DownloadMode != (DownloadMode{}) {
+		t.DownloadMode = opts.DownloadMode
+	}
+	if opts.SavePath != "" && t.SavePath != opts.SavePath {
+		t.SavePath = opts.SavePath
+		t.VideoFiles = nil
+	}
+	if opts.AutoConvert != nil {
+		autoConvert := *opts.AutoConvert
+		t.AutoConvert = &autoConvert
+	}
+	if opts.ConversionProfile != "" {
+		t.ConversionProfile = opts.ConversionProfile
+	}
+	if category := strings.TrimSpace(opts.Category); category != "" {
+		t.Category = category
+	}
+	if tags := normalizeTags(opts.Tags); len(tags) > 0 {
+		t.Tags = tags
+	}
+	if opts.Paused {
+		t.State = StatePaused
+	}
+}
+
+// SetFilePriorities объединяет приоритеты файлов с сохранёнными.
+// Обычный приоритет не хранится, так как применяется по умолчанию.
+func (sm *StateManager) SetFilePriorities(infoHash string, priorities map[string]FilePriority) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	torrent.FilePriorities = mergeFilePriorities(torrent.FilePriorities, priorities)
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// mergeFilePriorities возвращает новую карту с сохранёнными приоритетами, обновлёнными из priorities.
+// Новая карта нужна, так как копии торрента, выданные наружу, разделяют старую.
+func mergeFilePriorities(stored, priorities map[string]FilePriority) map[string]FilePriority {
+	merged := make(map[string]FilePriority, len(stored)+len(priorities))
+	for path, prio := range stored {
+		merged[path] = prio
+	}
+	for path, prio := range priorities {
+		if prio == FilePriorityNormal {
+			delete(merged, path)
+		} else {
+			merged[path] = prio
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// SetLimits сохраняет собственные ограничения скорости торрента
+func (sm *StateManager) SetLimits(infoHash string, limits RateLimits) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	torrent.Limits = limits
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// SetDownloadMode сохраняет порядок загрузки частей торрента
+func (sm *StateManager) SetDownloadMode(infoHash string, mode DownloadMode) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	torrent.DownloadMode = mode
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// EditTrackers запоминает добавленные и удалённые пользователем трекеры торрента.
+// Повторно добавленный трекер перестаёт считаться удалённым и наоборот.
+func (sm *StateManager) EditTrackers(infoHash string, add, remove []string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	// Собираем новые срезы, так как копии торрента, выданные наружу, разделяют старые
+	torrent.AddedTrackers = withoutStrings(appendMissing(torrent.AddedTrackers, add), remove)
+	torrent.RemovedTrackers = withoutStrings(appendMissing(torrent.RemovedTrackers, remove), add)
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// appendMissing возвращает новый срез с values и отсутствующими в нём значениями extra
+func appendMissing(values, extra []string) []string {
+	result := append([]string(nil), values...)
+	for _, v := range extra {
+		if !slices.Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// withoutStrings удаляет из values значения из remove
+func withoutStrings(values, remove []string) []string {
+	return slices.DeleteFunc(values, func(v string) bool {
+		return slices.Contains(remove, v)
+	})
+}
+
+// SetSavePath сохраняет папку с данными торрента.
+// Пути видеофайлов при смене папки сбрасываются и определяются заново.
+func (sm *StateManager) SetSavePath(infoHash string, savePath string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	if torrent.SavePath != savePath {
+		torrent.SavePath = savePath
+		torrent.VideoFiles = nil
+	}
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// SendEvent отправляет событие обработчику, не блокируясь при заполненном канале
+func (sm *StateManager) SendEvent(event Event) {
+	select {
+	case sm.eventChannel <- event:
+	default:
+		log.Println("Event channel is full, dropping event")
+	}
+}
+
+// nextQueuePosition возвращает место в конце очереди. Вызывается под sm.mu.
+func (sm *StateManager) nextQueuePosition() int {
+	last := 0
+	for _, t := range sm.states {
+		last = max(last, t.QueuePosition)
+	}
+	return last + 1
+}
+
+// assignMissingQueuePositions ставит в конец очереди торренты без места в ней
+func (sm *StateManager) assignMissingQueuePositions() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var missing []*Torrent
+	for _, t := range sm.states {
+		if t.QueuePosition == 0 {
+			missing = append(missing, t)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Name < missing[j].Name })
+	for _, t := range missing {
+		t.QueuePosition = sm.nextQueuePosition()
+	}
+}
+
+// queueOrder возвращает торренты в порядке очереди. Вызывается под sm.mu.
+func (sm *StateManager) queueOrder() []*Torrent {
+	ordered := make([]*Torrent, 0, len(sm.states))
+	for _, t := range sm.states {
+		ordered = append(ordered, t)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].QueuePosition != ordered[j].QueuePosition {
+			return ordered[i].QueuePosition < ordered[j].QueuePosition
+		}
+		return ordered[i].InfoHash < ordered[j].InfoHash
+	})
+	return ordered
+}
+
+// QueueOrder возвращает копии торрентов в порядке очереди
+func (sm *StateManager) QueueOrder() []Torrent {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ordered := sm.queueOrder()
+	result := make([]Torrent, 0, len(ordered))
+	for _, t := range ordered {
+		result = append(result, *t)
+	}
+	return result
+}
+
+// MoveInQueue перемещает торрент в очереди на delta мест, отрицательное значение двигает к началу
+func (sm *StateManager) MoveInQueue(infoHash string, delta int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.states[infoHash]; !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	ordered := sm.queueOrder()
+	from := 0
+	for i, t := range ordered {
+		if t.InfoHash == infoHash {
+			from = i
+			break
+		}
+	}
+	to := min(max(from+delta, 0), len(ordered)-1)
+	if to == from {
+		return nil
+	}
+
+	moved := ordered[from]
+	ordered = append(ordered[:from], ordered[from+1:]...)
+	ordered = append(ordered[:to], append([]*Torrent{moved}, ordered[to:]...)...)
+
+	// Места нумеруются заново, чтобы не оставалось пропусков после удалений
+	now := time.Now()
+	for i, t := range ordered {
+		t.QueuePosition = i + 1
+	}
+	moved.LastChecked = now
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// SetForceStart включает или выключает запуск торрента в обход очереди
+func (sm *StateManager) SetForceStart(infoHash string, force bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	torrent.ForceStart = force
+	torrent.LastChecked = time.Now()
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
 // RemoveTorrent removes a torrent from the state manager
 func (sm *StateManager) RemoveTorrent(infoHash string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	delete(sm.states, infoHash)
+	if err := sm.removeMetaInfo(infoHash); err != nil {
+		log.Printf("Failed to remove metainfo of %s: %v", infoHash, err)
+	}
 
 	// Schedule a save
 	select {
@@ -279,6 +665,114 @@ func (sm *StateManager) RemoveTorrent(infoHash string) {
 	}
 }
 
+// MarkAsFetchingMetadata помечает торрент как ожидающий метаданные и применяет параметры добавления.
+// Если торрента ещё нет в состоянии, он добавляется.
+func (sm *StateManager) MarkAsFetchingMetadata(torrent *Torrent, opts AddOptions) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	if existing, exists := sm.states[torrent.InfoHash]; exists {
+		// Приостановленный торрент остаётся на паузе, пока ждёт метаданные
+		if existing.State != StatePaused {
+			existing.State = StateFetchingMetadata
+		}
+		existing.Error = ""
+		existing.applyAddOptions(opts)
+		existing.LastChecked = now
+	} else {
+		torrent.State = StateFetchingMetadata
+		torrent.applyAddOptions(opts)
+		torrent.LastChecked = now
+		torrent.QueuePosition = sm.nextQueuePosition()
+		sm.states[torrent.InfoHash] = torrent
+	}
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+}
+
+// MarkMetadataReceived переносит данные активного торрента в состояние после получения метаданных.
+// Торренты, удалённые во время ожидания, игнорируются.
+func (sm *StateManager) MarkMetadataReceived(active *Torrent) {
+	sm.mu.RLock()
+	existing, exists := sm.states[active.InfoHash]
+	var merged Torrent
+	if exists {
+		merged = *existing
+	}
+	sm.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	merged.Name = active.Name
+	merged.Magnet = active.Magnet
+	merged.Size = active.Size
+	merged.SelectedSize = active.SelectedSize
+	merged.Done = active.Done
+	merged.DownloadedPercent = active.DownloadedPercent
+	merged.State = active.State
+	merged.Error = ""
+	merged.LastChecked = time.Now()
+
+	sm.updateTorrentState(&merged)
+
+	// Отправляем событие
+	event := Event{
+		Type:      "metadata_received",
+		Torrent:   &merged,
+		Timestamp: merged.LastChecked,
+	}
+
+	select {
+	case sm.eventChannel <- event:
+	default:
+		log.Println("Event channel is full, dropping event")
+	}
+}
+
+// MarkMetadataFailed помечает торрент, для которого не удалось получить метаданные
+func (sm *StateManager) MarkMetadataFailed(infoHash string, reason string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	torrent, exists := sm.states[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	now := time.Now()
+	torrent.State = StateMetadataFailed
+	torrent.Error = reason
+	torrent.LastChecked = now
+
+	// Сохраняем состояние
+	select {
+	case sm.saveChannel <- struct{}{}:
+	default:
+	}
+
+	// Отправляем событие
+	event := Event{
+		Type:      "metadata_failed",
+		Torrent:   torrent,
+		Timestamp: now,
+	}
+
+	select {
+	case sm.eventChannel <- event:
+	default:
+		log.Println("Event channel is full, dropping event")
+	}
+
+	return nil
+}
+
 // MarkAsPaused помечает торрент как приостановленный
 func (sm *StateManager) MarkAsPaused(infoHash string) error {
 	sm.mu.Lock()
@@ -371,7 +865,9 @@ func (sm *StateManager) MarkAsQueued(infoHash string) error {
 		return fmt.Errorf("torrent %s not found", infoHash)
 	}
 
-	if torrent.State != StateCompleted {
+	// Завершённый торрент может показываться приостановленным или ждущим в очереди раздачи,
+	// поэтому проверяется загрузка, а не состояние
+	if !torrent.Done {
 		return fmt.Errorf("torrent %s is not completed yet", infoHash)
 	}
 
@@ -428,8 +924,8 @@ func (sm *StateManager) MarkAsConverting(infoHash string) error {
 	return nil
 }
 
-// MarkAsConverted помечает торрент как успешно конвертированный
-func (sm *StateManager) MarkAsConverted(infoHash string) error {
+// MarkAsConverted помечает торрент как успешно конвертированный профилем profile
+func (sm *StateManager) MarkAsConverted(infoHash string, profile ConversionProfile) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -438,6 +934,19 @@ func (sm *StateManager) MarkAsConverted(infoHash string) error {
 		return fmt.Errorf("torrent %s not found", infoHash)
 	}
 
+	if profile == "" {
+		profile = ConversionTranscode
+	}
+	torrent.ConvertedProfile = profile
+	// Копии торрента из GetTorrent разделяют срез VideoFiles, поэтому он заменяется новым, а не меняется на месте
+	if torrent.VideoFiles != nil {
+		videoFiles := make([]VideoFile, len(torrent.VideoFiles))
+		for i, video := range torrent.VideoFiles {
+			video.Playlist = profile.playlist(video.Path)
+			videoFiles[i] = video
+		}
+		torrent.VideoFiles = videoFiles
+	}
 	torrent.ConvertingState = StateConverted
 	now := time.Now()
 	torrent.ConvertedAt = &now
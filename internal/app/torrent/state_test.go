@@ -0,0 +1,130 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestStateManager возвращает менеджер состояний без файла и фоновых процессов
+func newTestStateManager(torrents ...*Torrent) *StateManager {
+	sm := &StateManager{
+		states:       make(map[string]*Torrent),
+		eventChannel: make(chan Event, 100),
+		saveChannel:  make(chan struct{}, 1),
+	}
+	for _, t := range torrents {
+		sm.states[t.InfoHash] = t
+	}
+	return sm
+}
+
+func TestMarkAsQueued(t *testing.T) {
+	tests := []struct {
+		name      string
+		torrent   Torrent
+		wantErr   bool
+		wantState ConvertingState
+	}{
+		{
+			name:      "completed",
+			torrent:   Torrent{State: StateCompleted, Done: true},
+			wantState: StateConvertingQueued,
+		},
+		{
+			name:      "seed waiting in the queue",
+			torrent:   Torrent{State: StateQueued, Done: true},
+			wantState: StateConvertingQueued,
+		},
+		{
+			name:      "paused after completion",
+			torrent:   Torrent{State: StatePaused, Done: true},
+			wantState: StateConvertingQueued,
+		},
+		{
+			name:      "failed conversion is queued again",
+			torrent:   Torrent{State: StateCompleted, Done: true, ConvertingState: StateConvertingError},
+			wantState: StateConvertingQueued,
+		},
+		{
+			name:      "already converted stays converted",
+			torrent:   Torrent{State: StateCompleted, Done: true, ConvertingState: StateConverted},
+			wantState: StateConverted,
+		},
+		{
+			name:      "still downloading",
+			torrent:   Torrent{State: StateDownloading},
+			wantErr:   true,
+			wantState: StateNotConverted,
+		},
+		{
+			name:      "paused before completion",
+			torrent:   Torrent{State: StatePaused},
+			wantErr:   true,
+			wantState: StateNotConverted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			torrent := tt.torrent
+			torrent.InfoHash = testHashX
+			sm := newTestStateManager(&torrent)
+
+			err := sm.MarkAsQueued(testHashX)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MarkAsQueued() error = %v, want error %v", err, tt.wantErr)
+			}
+			if torrent.ConvertingState != tt.wantState {
+				t.Errorf("converting state = %v, want %v", torrent.ConvertingState, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestMarkAsQueuedUnknownTorrent(t *testing.T) {
+	if err := newTestStateManager().MarkAsQueued(testHashX); err == nil {
+		t.Error("MarkAsQueued() of an unknown torrent returned no error")
+	}
+}
+
+func TestMarkAsConvertedKeepsCopiesIntact(t *testing.T) {
+	video := filepath.Join("Show", "e01.mkv")
+	sm := newTestStateManager(&Torrent{
+		InfoHash:        testHashX,
+		Done:            true,
+		ConvertingState: StateConverting,
+		VideoFiles:      []VideoFile{{Path: video}},
+	})
+
+	before, err := sm.GetTorrent(testHashX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Копия читается одновременно с изменением, как при запросе списка торрентов во время конвертации
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			_ = before.VideoFiles[0].Playlist
+		}
+	}()
+	if err := sm.MarkAsConverted(testHashX, ConversionCopy); err != nil {
+		t.Fatalf("MarkAsConverted() error = %v", err)
+	}
+	<-done
+
+	if before.VideoFiles[0].Playlist != "" {
+		t.Errorf("earlier copy sees playlist %q, want it unchanged", before.VideoFiles[0].Playlist)
+	}
+	after, err := sm.GetTorrent(testHashX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("Show", "e01.m3u8"); after.VideoFiles[0].Playlist != want {
+		t.Errorf("playlist = %q, want %q", after.VideoFiles[0].Playlist, want)
+	}
+	if after.ConvertedProfile != ConversionCopy || after.ConvertingState != StateConverted {
+		t.Errorf("converted profile = %q, state = %v, want copy and converted", after.ConvertedProfile, after.ConvertingState)
+	}
+}
@@ -0,0 +1,178 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// statsSampleInterval период снятия счётчиков для расчёта скорости
+	statsSampleInterval = time.Second
+	// statsWindow сколько последних замеров усредняется при расчёте скорости
+	statsWindow = 5
+)
+
+// TransferStats текущая статистика обмена торрента, не сохраняется в состояние
+type TransferStats struct {
+	// DownloadRate и UploadRate скорость в байтах в секунду
+	DownloadRate int64 `json:"downloadRate"`
+	UploadRate   int64 `json:"uploadRate"`
+	// Downloaded и Uploaded объём полезных данных за текущую сессию
+	Downloaded int64   `json:"downloaded"`
+	Uploaded   int64   `json:"uploaded"`
+	Ratio      float64 `json:"ratio"`
+	// ConnectedPeers и ConnectedSeeds подключённые пиры, TotalPeers и TotalSeeds известные в рое
+	ConnectedPeers int `json:"connectedPeers"`
+	TotalPeers     int `json:"totalPeers"`
+	ConnectedSeeds int `json:"connectedSeeds"`
+	TotalSeeds     int `json:"totalSeeds"`
+	// ETA оставшееся время загрузки в секундах, -1 если неизвестно
+	ETA      int64           `json:"eta"`
+	Trackers []TrackerStatus `json:"trackers"`
+	// Recheck ход проверки данных, если она выполняется
+	Recheck *RecheckProgress `json:"recheck,omitempty"`
+	// MovingTo папка, в которую сейчас переносятся данные торрента
+	MovingTo string `json:"movingTo,omitempty"`
+	// BlockedPeers разные адреса из ответов трекеров, отклонённые списком блокировки.
+	// DHT, PEX и входящие соединения anacrolix проверяет без привязки к торренту, они учтены только в общем числе.
+	BlockedPeers int64 `json:"blockedPeers"`
+}
+
+type statsSample struct {
+	at      time.Time
+	read    int64
+	written int64
+}
+
+// statsSampler хранит последние замеры счётчиков торрентов
+type statsSampler struct {
+	mu      sync.Mutex
+	samples map[metainfo.Hash][]statsSample
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func newStatsSampler() *statsSampler {
+	return &statsSampler{
+		samples:  make(map[metainfo.Hash][]statsSample),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// run снимает замеры, пока не вызван stop
+func (s *statsSampler) run(cl *torrent.Client) {
+	ticker := time.NewTicker(statsSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case now := <-ticker.C:
+			s.sample(cl, now)
+		}
+	}
+}
+
+func (s *statsSampler) sample(cl *torrent.Client, now time.Time) {
+	active := cl.Torrents()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[metainfo.Hash]struct{}, len(active))
+	for _, t := range active {
+		hash := t.InfoHash()
+		seen[hash] = struct{}{}
+
+		stats := t.Stats()
+		samples := append(s.samples[hash], statsSample{
+			at:      now,
+			read:    stats.BytesReadUsefulData.Int64(),
+			written: stats.BytesWrittenData.Int64(),
+		})
+		if len(samples) > statsWindow {
+			samples = samples[len(samples)-statsWindow:]
+		}
+		s.samples[hash] = samples
+	}
+
+	for hash := range s.samples {
+		if _, ok := seen[hash]; !ok {
+			delete(s.samples, hash)
+		}
+	}
+}
+
+// rates возвращает среднюю скорость загрузки и отдачи за окно замеров
+func (s *statsSampler) rates(hash metainfo.Hash) (download, upload int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := s.samples[hash]
+	if len(samples) < 2 {
+		return 0, 0
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	download = int64(float64(last.read-first.read) / elapsed)
+	upload = int64(float64(last.written-first.written) / elapsed)
+	return download, upload
+}
+
+func (s *statsSampler) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
+
+// transferStats собирает статистику обмена торрента
+func (c *Client) transferStats(t *torrent.Torrent, selected, completed int64) *TransferStats {
+	stats := t.Stats()
+	downloadRate, uploadRate := c.sampler.rates(t.InfoHash())
+
+	result := &TransferStats{
+		DownloadRate:   downloadRate,
+		UploadRate:     uploadRate,
+		Downloaded:     stats.BytesReadUsefulData.Int64(),
+		Uploaded:       stats.BytesWrittenData.Int64(),
+		ConnectedPeers: stats.ActivePeers,
+		TotalPeers:     stats.TotalPeers,
+		ConnectedSeeds: stats.ConnectedSeeders,
+		ETA:            -1,
+		Trackers:       c.trackers.statuses(t.InfoHash()),
+		Recheck:        c.rechecks.get(t.InfoHash()),
+		MovingTo:       c.storage.movingTo(t.InfoHash()),
+	}
+	if c.blocklist != nil {
+		result.BlockedPeers = c.blocklist.blockedPeers(t.InfoHash())
+	}
+
+	// Рейтинг считается от скачанного с диска, если в этой сессии загрузки не было
+	base := max(result.Downloaded, completed)
+	if base > 0 {
+		result.Ratio = float64(result.Uploaded) / float64(base)
+	}
+
+	for _, tr := range result.Trackers {
+		result.TotalPeers = max(result.TotalPeers, tr.Seeders+tr.Leechers)
+		result.TotalSeeds = max(result.TotalSeeds, tr.Seeders)
+	}
+	result.TotalSeeds = max(result.TotalSeeds, result.ConnectedSeeds)
+
+	switch left := selected - completed; {
+	case left <= 0:
+		result.ETA = 0
+	case downloadRate > 0:
+		result.ETA = left / downloadRate
+	}
+
+	return result
+}
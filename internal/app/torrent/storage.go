@@ -0,0 +1,341 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ErrSavePathNotAllowed is returned for save paths outside of the configured storage roots.
+var ErrSavePathNotAllowed = errors.New("save path is outside of the configured storage roots")
+
+// ErrMoveInProgress is returned when the storage of a torrent is already being moved.
+var ErrMoveInProgress = errors.New("torrent storage is already being moved")
+
+// errMoveReverted означает, что перенос не удался и торрент добавлен в клиент заново из старой папки
+var errMoveReverted = errors.New("torrent restored in its old location")
+
+// storageDirs хранит папки, в которые загружаются торренты.
+// anacrolix запрашивает папку один раз, когда становятся известны метаданные.
+type storageDirs struct {
+	mu sync.Mutex
+	// roots разрешённые корни: папка торрентов и дополнительные папки сохранения
+	roots []string
+	dirs  map[metainfo.Hash]string
+	// moving торренты, данные которых сейчас переносятся, и папка назначения
+	moving map[metainfo.Hash]string
+}
+
+func newStorageDirs(roots []string) *storageDirs {
+	return &storageDirs{
+		roots:  roots,
+		dirs:   make(map[metainfo.Hash]string),
+		moving: make(map[metainfo.Hash]string),
+	}
+}
+
+// torrentDir реализует storage.TorrentDirFilePathMaker
+func (sd *storageDirs) torrentDir(baseDir string, _ *metainfo.Info, infoHash metainfo.Hash) string {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if dir, ok := sd.dirs[infoHash]; ok {
+		return dir
+	}
+	return baseDir
+}
+
+// set задаёт папку торрента, пустая строка возвращает папку по умолчанию
+func (sd *storageDirs) set(hash metainfo.Hash, dir string) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if dir == "" {
+		delete(sd.dirs, hash)
+	} else {
+		sd.dirs[hash] = dir
+	}
+}
+
+// get возвращает папку торрента, пустая строка означает папку по умолчанию
+func (sd *storageDirs) get(hash metainfo.Hash) string {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.dirs[hash]
+}
+
+// movingTo возвращает папку, в которую переносятся данные торрента, или пустую строку
+func (sd *storageDirs) movingTo(hash metainfo.Hash) string {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.moving[hash]
+}
+
+// forget удаляет сведения об удалённом из клиента торренте
+func (sd *storageDirs) forget(hash metainfo.Hash) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	delete(sd.dirs, hash)
+}
+
+// ResolveSavePath checks that a save path lies inside one of the storage roots and returns it as an absolute path.
+// The torrents directory itself resolves to an empty string, which stands for the default location.
+func (c *Client) ResolveSavePath(savePath string) (string, error) {
+	if savePath == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(savePath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range c.storage.roots {
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if abs == c.storage.roots[0] {
+			return "", nil
+		}
+		return abs, nil
+	}
+	return "", fmt.Errorf("%s: %w", savePath, ErrSavePathNotAllowed)
+}
+
+// torrentDir returns the directory that holds the data of a torrent.
+func (c *Client) torrentDir(hash metainfo.Hash) string {
+	return c.storage.torrentDir(c.storage.roots[0], nil, hash)
+}
+
+// setSavePath задаёт папку торрента, который ещё не добавлен в клиент
+func (c *Client) setSavePath(hash metainfo.Hash, savePath string) {
+	if _, ok := c.tClient.Torrent(hash); ok {
+		// Хранилище уже открыто, папку меняет только MoveStorage
+		return
+	}
+	if savePath != "" {
+		c.storage.set(hash, savePath)
+	}
+}
+
+// StartMoveStorage moves the files of a torrent and its HLS output to savePath in the background.
+// HLS output is moved only if stored shows that the torrent was converted.
+// The torrent keeps seeding from the old location until the files are in place, then it is
+// re-added from the new one. The result is sent to the returned channel: on error the torrent stays
+// in its old location. The caller must apply the stored settings of the torrent again once the move succeeds,
+// or when the error wraps errMoveReverted, since the torrent was re-added in its old location then.
+func (c *Client) StartMoveStorage(infoHash string, savePath string, stored *Torrent) (<-chan error, error) {
+	hash := metainfo.NewHashFromHex(infoHash)
+	t, ok := c.tClient.Torrent(hash)
+	if !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+
+	target := savePath
+	if target == "" {
+		target = c.storage.roots[0]
+	}
+
+	c.storage.mu.Lock()
+	if _, moving := c.storage.moving[hash]; moving {
+		c.storage.mu.Unlock()
+		return nil, ErrMoveInProgress
+	}
+	source := c.storage.dirs[hash]
+	if source == "" {
+		source = c.storage.roots[0]
+	}
+	if source == target {
+		c.storage.mu.Unlock()
+		return nil, fmt.Errorf("torrent %s is already stored in %s", infoHash, target)
+	}
+	if t.Info() == nil {
+		// Без метаданных неизвестно, какие файлы торрента уже лежат на диске
+		c.storage.mu.Unlock()
+		return nil, ErrNoMetadata
+	}
+	c.storage.moving[hash] = target
+	c.storage.mu.Unlock()
+
+	entries, err := c.storageEntries(t, stored)
+	if err == nil {
+		err = checkTargetsFree(target, entries)
+	}
+	if err != nil {
+		c.storage.mu.Lock()
+		delete(c.storage.moving, hash)
+		c.storage.mu.Unlock()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := c.moveStorage(t, source, target, savePath, entries)
+
+		c.storage.mu.Lock()
+		delete(c.storage.moving, hash)
+		c.storage.mu.Unlock()
+
+		done <- err
+	}()
+
+	return done, nil
+}
+
+// moveStorage копирует данные, переключает торрент на новую папку и удаляет старые файлы
+func (c *Client) moveStorage(t *torrent.Torrent, source, target, savePath string, entries []string) error {
+	hash := t.InfoHash()
+	log.Printf("[torrent] Moving %s from %s to %s", t.Name(), source, target)
+
+	// Загрузка останавливается, чтобы скопированные файлы не устарели, раздача продолжается
+	c.throttle.hold(t, holdMoving)
+
+	var copied []string
+	for _, entry := range entries {
+		from := filepath.Join(source, entry)
+		if _, err := os.Lstat(from); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		to := filepath.Join(target, entry)
+		copied = append(copied, to)
+		if err := linkOrCopyTree(from, to); err != nil {
+			for _, path := range copied {
+				_ = os.RemoveAll(path)
+			}
+			c.throttle.unhold(t, holdMoving)
+			return fmt.Errorf("failed to copy %s: %w", from, err)
+		}
+	}
+
+	mi := torrentMetaInfo(t)
+	oldDir := c.storage.get(hash)
+	t.Drop()
+	// Вместе с удалённым торрентом снимаются и его запреты, в том числе holdMoving
+	c.throttle.forget(hash)
+	c.pieces.forget(hash)
+	c.storage.set(hash, savePath)
+	// Сведения о загруженных частях привязаны к хешу и сохраняются, повторная проверка не нужна
+	if _, err := c.tClient.AddTorrent(&mi); err != nil {
+		err = fmt.Errorf("failed to re-add torrent after move: %w", err)
+		// Возвращаем торрент на старое место, скопированные файлы больше не нужны
+		for _, path := range copied {
+			_ = os.RemoveAll(path)
+		}
+		c.storage.set(hash, oldDir)
+		if _, restoreErr := c.tClient.AddTorrent(&mi); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore torrent in %s: %w", source, restoreErr))
+		}
+		return fmt.Errorf("%w: %w", errMoveReverted, err)
+	}
+
+	// Торрент уже работает из новой папки, поэтому ошибка удаления старых файлов не отменяет перенос
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(source, entry)); err != nil {
+			log.Printf("[torrent] Failed to remove %s after move: %v", filepath.Join(source, entry), err)
+		}
+	}
+	return nil
+}
+
+// storageEntries возвращает пути верхнего уровня относительно папки торрента:
+// файл или папку торрента и результаты конвертации, лежащие рядом с ними
+func (c *Client) storageEntries(t *torrent.Torrent, stored *Torrent) ([]string, error) {
+	if !stored.hasConversionOutput() {
+		return []string{t.Name()}, nil
+	}
+	videos, err := c.GetTorrentVideoFiles(t)
+	if err != nil {
+		return nil, err
+	}
+	return topLevelEntries(c.torrentDir(t.InfoHash()), t.Name(), videos, stored.ConvertedProfile)
+}
+
+// topLevelEntries возвращает name и верхние уровни путей результатов конвертации videos внутри dir без повторов.
+// Учитываются только результаты, плейлист которых есть на диске.
+func topLevelEntries(dir, name string, videos []string, profile ConversionProfile) ([]string, error) {
+	entries := []string{name}
+	seen := map[string]struct{}{name: {}}
+
+	for _, video := range videos {
+		for _, path := range hlsOutputs(video, profile) {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || checkInsideDir(dir, path) != nil {
+				return nil, fmt.Errorf("%s: %w", path, ErrPathOutsideDir)
+			}
+			top := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+			if _, ok := seen[top]; !ok {
+				seen[top] = struct{}{}
+				entries = append(entries, top)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// checkTargetsFree проверяет, что перенос не перезапишет чужие файлы
+func checkTargetsFree(target string, entries []string) error {
+	for _, entry := range entries {
+		path := filepath.Join(target, entry)
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+	return nil
+}
+
+// linkOrCopyTree переносит файл или папку, создавая жёсткие ссылки в пределах одного диска
+// и копируя данные между дисками. Исходные файлы остаются на месте.
+func linkOrCopyTree(from, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(to, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0o755)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := os.Link(path, dst); err == nil {
+			return nil
+		}
+		return copyFile(path, dst)
+	})
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer filehelpers.CloseFile(src)
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
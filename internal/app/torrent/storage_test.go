@@ -0,0 +1,174 @@
+package torrent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// createFiles создаёт пустые файлы внутри dir вместе с нужными папками
+func createFiles(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTopLevelEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		torrent string
+		files   []string
+		videos  []string
+		profile ConversionProfile
+		want    []string
+	}{
+		{
+			name:    "folder beside a video without a playlist is not output",
+			torrent: "Movie.mkv",
+			files:   []string{"Movie.mkv", "Movie/notes.txt"},
+			videos:  []string{"Movie.mkv"},
+			profile: ConversionTranscode,
+			want:    []string{"Movie.mkv"},
+		},
+		{
+			name:    "copy keeps its playlist beside the video",
+			torrent: "Movie.mkv",
+			files:   []string{"Movie.mkv", "Movie.m3u8", "Movie/segment_000.m4s"},
+			videos:  []string{"Movie.mkv"},
+			profile: ConversionCopy,
+			want:    []string{"Movie.mkv", "Movie", "Movie.m3u8"},
+		},
+		{
+			name:    "transcode keeps its playlist in the segment folder",
+			torrent: "Movie.mkv",
+			files:   []string{"Movie.mkv", "Movie/playlist.m3u8", "Movie.m3u8"},
+			videos:  []string{"Movie.mkv"},
+			profile: ConversionTranscode,
+			want:    []string{"Movie.mkv", "Movie"},
+		},
+		{
+			name:    "unknown profile is found by its playlist",
+			torrent: "Movie.mkv",
+			files:   []string{"Movie.mkv", "Movie/master.m3u8"},
+			videos:  []string{"Movie.mkv"},
+			want:    []string{"Movie.mkv", "Movie"},
+		},
+		{
+			name:    "playlist of another profile is ignored",
+			torrent: "Movie.mkv",
+			files:   []string{"Movie.mkv", "Movie.m3u8"},
+			videos:  []string{"Movie.mkv"},
+			profile: ConversionAdaptive,
+			want:    []string{"Movie.mkv"},
+		},
+		{
+			name:    "folder holds the output of every video",
+			torrent: "Show",
+			files:   []string{"Show/e01.mkv", "Show/e01/playlist.m3u8", "Show/Season 2/e01.mp4", "Show/Season 2/e01/playlist.m3u8"},
+			videos:  []string{"Show/e01.mkv", "Show/Season 2/e01.mp4"},
+			profile: ConversionTranscode,
+			want:    []string{"Show"},
+		},
+		{
+			name:    "no videos",
+			torrent: "Album",
+			want:    []string{"Album"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createFiles(t, dir, tt.files...)
+			var videos []string
+			for _, video := range tt.videos {
+				videos = append(videos, filepath.Join(dir, video))
+			}
+
+			got, err := topLevelEntries(dir, tt.torrent, videos, tt.profile)
+			if err != nil {
+				t.Fatalf("topLevelEntries() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("topLevelEntries() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopLevelEntriesOutsideDir(t *testing.T) {
+	dir := t.TempDir()
+	elsewhere := t.TempDir()
+	createFiles(t, elsewhere, "Movie.mkv", "Movie/playlist.m3u8")
+
+	_, err := topLevelEntries(dir, "Movie.mkv", []string{filepath.Join(elsewhere, "Movie.mkv")}, ConversionTranscode)
+	if !errors.Is(err, ErrPathOutsideDir) {
+		t.Errorf("topLevelEntries() error = %v, want %v", err, ErrPathOutsideDir)
+	}
+}
+
+func TestHasConversionOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		torrent *Torrent
+		want    bool
+	}{
+		{name: "no record", want: false},
+		{name: "never converted", torrent: &Torrent{}, want: false},
+		{name: "conversion failed", torrent: &Torrent{ConvertingState: StateConvertingError}, want: false},
+		{name: "converted before profiles were recorded", torrent: &Torrent{ConvertingState: StateConverted}, want: true},
+		{name: "converted again", torrent: &Torrent{ConvertingState: StateConverting, ConvertedProfile: ConversionCopy}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.torrent.hasConversionOutput(); got != tt.want {
+				t.Errorf("hasConversionOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTargetsFree(t *testing.T) {
+	target := t.TempDir()
+	if err := os.WriteFile(filepath.Join(target, "Movie.mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(target, "Show"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Битая ссылка тоже занимает имя
+	if err := os.Symlink(filepath.Join(target, "missing"), filepath.Join(target, "Link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{name: "nothing there", entries: []string{"Other.mkv", "Other", "Other.m3u8"}},
+		{name: "no entries"},
+		{name: "file exists", entries: []string{"Movie", "Movie.mkv"}, wantErr: true},
+		{name: "folder exists", entries: []string{"Show"}, wantErr: true},
+		{name: "broken symlink exists", entries: []string{"Link"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTargetsFree(target, tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkTargetsFree(%q) error = %v, want error %v", tt.entries, err, tt.wantErr)
+			}
+		})
+	}
+}
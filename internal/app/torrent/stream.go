@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// streamReadahead сколько байт после позиции чтения загружается заранее
+const streamReadahead = 16 << 20
+
+var _ io.ReadSeekCloser = (*FileStream)(nil)
+
+// FileStream читает файл активного торрента, пока он ещё загружается.
+// Куски под позицией чтения получают наивысший приоритет, поэтому перемотка сразу меняет порядок загрузки.
+type FileStream struct {
+	reader torrent.Reader
+	ctx    context.Context
+	Name   string
+	Size   int64
+}
+
+// Read читает данные, ожидая загрузки нужных кусков, пока не завершится контекст
+func (fs *FileStream) Read(p []byte) (int, error) {
+	return fs.reader.ReadContext(fs.ctx, p)
+}
+
+func (fs *FileStream) Seek(offset int64, whence int) (int64, error) {
+	return fs.reader.Seek(offset, whence)
+}
+
+func (fs *FileStream) Close() error {
+	return fs.reader.Close()
+}
+
+// OpenFile opens a file inside an active torrent for streaming.
+// Reads are bound to ctx, so a disconnected client does not keep waiting for pieces.
+func (c *Client) OpenFile(ctx context.Context, infoHash string, path string) (*FileStream, error) {
+	t, ok := c.tClient.Torrent(metainfo.NewHashFromHex(infoHash))
+	if !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+
+	for _, f := range t.Files() {
+		if f.DisplayPath() != path {
+			continue
+		}
+
+		reader := f.NewReader()
+		reader.SetReadahead(streamReadahead)
+		// Отдаём данные сразу после загрузки, не дожидаясь проверки всего куска
+		reader.SetResponsive()
+
+		return &FileStream{
+			reader: reader,
+			ctx:    ctx,
+			Name:   f.DisplayPath(),
+			Size:   f.Length(),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("file %s not found in torrent %s: %w", path, infoHash, ErrFileNotFound)
+}
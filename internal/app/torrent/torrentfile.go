@@ -0,0 +1,78 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// MaxTorrentFileSize ограничивает размер принимаемого .torrent файла
+const MaxTorrentFileSize = 10 << 20
+
+// ErrInvalidTorrentFile возвращается, если .torrent файл не прошёл проверку
+var ErrInvalidTorrentFile = errors.New("invalid torrent file")
+
+// LoadTorrentFile читает .torrent файл из r целиком в память и проверяет его содержимое.
+func LoadTorrentFile(r io.Reader) (*metainfo.MetaInfo, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxTorrentFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidTorrentFile)
+	}
+	if len(data) > MaxTorrentFileSize {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", ErrInvalidTorrentFile, MaxTorrentFileSize)
+	}
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+	if err := validateInfo(&info); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTorrentFile, err)
+	}
+
+	return mi, nil
+}
+
+// validateInfo проверяет info-словарь торрента на очевидные ошибки
+func validateInfo(info *metainfo.Info) error {
+	if info.BestName() == "" || info.BestName() == metainfo.NoName {
+		return errors.New("missing name")
+	}
+	if info.PieceLength <= 0 {
+		return errors.New("invalid piece length")
+	}
+	if info.TotalLength() <= 0 {
+		return errors.New("torrent has no data")
+	}
+	if info.HasV1() && !info.HasV2() {
+		if len(info.Pieces)%20 != 0 {
+			return errors.New("invalid pieces length")
+		}
+		expected := (info.TotalLength() + info.PieceLength - 1) / info.PieceLength
+		if int64(len(info.Pieces)/20) != expected {
+			return errors.New("pieces count does not match total length")
+		}
+	}
+	for _, fi := range info.UpvertedFiles() {
+		if fi.Length < 0 {
+			return errors.New("negative file length")
+		}
+		for _, part := range fi.BestPath() {
+			if part == ".." {
+				return errors.New("file path escapes torrent directory")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,616 @@
+package torrent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+const (
+	// trackerSyncInterval период сверки списка трекеров с торрентами клиента
+	trackerSyncInterval = 5 * time.Second
+	// minAnnounceInterval не даёт анонсировать чаще, чем раз в минуту
+	minAnnounceInterval = time.Minute
+	// errorAnnounceInterval пауза перед повтором после ошибки трекера
+	errorAnnounceInterval = 2 * time.Minute
+	// announceNumWant сколько пиров запрашивается у трекера
+	announceNumWant = 200
+	// stoppedAnnounceTimeout короче обычного, чтобы не задерживать остановку клиента
+	stoppedAnnounceTimeout = 5 * time.Second
+)
+
+// Состояния анонса на трекер
+const (
+	TrackerNotContacted = "not_contacted"
+	TrackerUpdating     = "updating"
+	TrackerWorking      = "working"
+	TrackerError        = "error"
+	// TrackerStopped торрент приостановлен или ждёт в очереди, трекеру отправлено событие stopped
+	TrackerStopped = "stopped"
+)
+
+// TrackerStatus состояние анонса торрента на трекер
+type TrackerStatus struct {
+	URL          string     `json:"url"`
+	Tier         int        `json:"tier"`
+	Status       string     `json:"status"`
+	Peers        int        `json:"peers"`
+	Seeders      int        `json:"seeders"`
+	Leechers     int        `json:"leechers"`
+	LastAnnounce *time.Time `json:"lastAnnounce,omitempty"`
+	NextAnnounce *time.Time `json:"nextAnnounce,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// trackerManager анонсирует торренты на трекеры.
+// Встроенные анонсы anacrolix отключены, так как не сообщают своё состояние.
+// Торренты, которые не обмениваются данными, не анонсируются, чтобы не получать пиров.
+type trackerManager struct {
+	cl  *torrent.Client
+	key int32
+	// stopped сообщает, что торрент приостановлен или ждёт в очереди
+	stopped func(metainfo.Hash) bool
+	// httpProxy прокси для HTTP трекеров, udpAllowed false запрещает UDP трекеры, чтобы не обходить SOCKS5 прокси
+	httpProxy  func(*http.Request) (*url.URL, error)
+	udpAllowed bool
+	// blocklist отсеивает пиров из ответов трекеров, может быть nil
+	blocklist *blocklist
+
+	mu       sync.Mutex
+	torrents map[metainfo.Hash]map[string]*trackerWorker
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// errUDPTrackerProxied сообщает, что UDP трекер пропущен, так как прокси его не поддерживает
+var errUDPTrackerProxied = errors.New("UDP trackers are not supported through a SOCKS5 proxy")
+
+// errWebTorrentTracker сообщает, что трекер WebTorrent пропущен: клиент не устанавливает WebRTC соединения
+var errWebTorrentTracker = errors.New("WebTorrent trackers are not supported")
+
+func newTrackerManager(cl *torrent.Client, stopped func(metainfo.Hash) bool, httpProxy func(*http.Request) (*url.URL, error), udpAllowed bool, bl *blocklist) *trackerManager {
+	var key [4]byte
+	_, _ = rand.Read(key[:])
+
+	return &trackerManager{
+		cl:         cl,
+		key:        int32(binary.BigEndian.Uint32(key[:])),
+		stopped:    stopped,
+		httpProxy:  httpProxy,
+		udpAllowed: udpAllowed,
+		blocklist:  bl,
+		torrents:   make(map[metainfo.Hash]map[string]*trackerWorker),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// run периодически сверяет анонсы с трекерами торрентов, пока не вызван stop
+func (tm *trackerManager) run() {
+	ticker := time.NewTicker(trackerSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		tm.sync()
+		select {
+		case <-tm.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync запускает анонсы для новых трекеров и останавливает для удалённых
+func (tm *trackerManager) sync() {
+	active := make(map[metainfo.Hash]*torrent.Torrent)
+	for _, t := range tm.cl.Torrents() {
+		active[t.InfoHash()] = t
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	select {
+	case <-tm.stopChan:
+		return
+	default:
+	}
+
+	for hash, workers := range tm.torrents {
+		if _, ok := active[hash]; !ok {
+			for _, w := range workers {
+				w.stop()
+			}
+			delete(tm.torrents, hash)
+		}
+	}
+
+	for hash, t := range active {
+		stopped := tm.stopped(hash)
+		workers, ok := tm.torrents[hash]
+		if !ok {
+			workers = make(map[string]*trackerWorker)
+			tm.torrents[hash] = workers
+		}
+
+		mi := t.Metainfo()
+		wanted := make(map[string]int)
+		for tier, urls := range mi.UpvertedAnnounceList() {
+			for _, u := range urls {
+				if _, seen := wanted[u]; !seen {
+					wanted[u] = tier
+				}
+			}
+		}
+
+		for u, w := range workers {
+			if _, ok := wanted[u]; !ok {
+				w.stop()
+				delete(workers, u)
+			}
+		}
+		for u, tier := range wanted {
+			if w, ok := workers[u]; ok {
+				if w.t == t {
+					w.setTier(tier)
+					w.setStopped(stopped)
+					continue
+				}
+				// Торрент удалён и добавлен заново с тем же хешем, прежний worker анонсирует закрытый торрент
+				w.stop()
+			}
+			w := &trackerWorker{
+				manager:    tm,
+				t:          t,
+				url:        u,
+				tier:       tier,
+				stopped:    stopped,
+				status:     TrackerNotContacted,
+				reannounce: make(chan struct{}, 1),
+				stopChan:   make(chan struct{}),
+			}
+			workers[u] = w
+			tm.wg.Add(1)
+			go w.run()
+		}
+	}
+}
+
+// removeWorker убирает завершившийся worker, если его ещё не заменили новым
+func (tm *trackerManager) removeWorker(w *trackerWorker) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	hash := w.t.InfoHash()
+	workers := tm.torrents[hash]
+	if workers[w.url] != w {
+		return
+	}
+	delete(workers, w.url)
+	if len(workers) == 0 {
+		delete(tm.torrents, hash)
+	}
+}
+
+// statuses возвращает состояние трекеров торрента, отсортированное по уровню и адресу
+func (tm *trackerManager) statuses(hash metainfo.Hash) []TrackerStatus {
+	tm.mu.Lock()
+	workers := tm.torrents[hash]
+	result := make([]TrackerStatus, 0, len(workers))
+	for _, w := range workers {
+		result = append(result, w.snapshot())
+	}
+	tm.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tier != result[j].Tier {
+			return result[i].Tier < result[j].Tier
+		}
+		return result[i].URL < result[j].URL
+	})
+	return result
+}
+
+// stop останавливает все анонсы, отправляя трекерам событие stopped
+func (tm *trackerManager) stop() {
+	tm.closeOnce.Do(func() {
+		tm.mu.Lock()
+		close(tm.stopChan)
+		for _, workers := range tm.torrents {
+			for _, w := range workers {
+				w.stop()
+			}
+		}
+		tm.mu.Unlock()
+	})
+	tm.wg.Wait()
+}
+
+// trackerWorker анонсирует один торрент на один трекер
+type trackerWorker struct {
+	manager *trackerManager
+	t       *torrent.Torrent
+	url     string
+
+	mu   sync.Mutex
+	tier int
+	// stopped торрент не обменивается данными, анонсы приостановлены
+	stopped      bool
+	status       string
+	peers        int
+	seeders      int
+	leechers     int
+	lastAnnounce time.Time
+	nextAnnounce time.Time
+	err          error
+
+	reannounce chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+}
+
+func (w *trackerWorker) run() {
+	defer w.manager.wg.Done()
+
+	event := tracker.Started
+	completedSent := false
+	// Событие completed отправляется, только если загрузка завершилась при нас
+	sawIncomplete := false
+	// started трекер знает о торренте, при остановке ему нужно отправить stopped
+	started := false
+
+	for {
+		if w.isStopped() {
+			if started {
+				w.announce(tracker.Stopped)
+				started = false
+			}
+			w.markStopped()
+			// Анонсы возобновляются, когда setStopped будит worker через reannounce
+			select {
+			case <-w.stopChan:
+				return
+			case <-w.t.Closed():
+				w.manager.removeWorker(w)
+				return
+			case <-w.reannounce:
+			}
+			event = tracker.Started
+			continue
+		}
+
+		left := w.bytesLeft()
+		if left != 0 {
+			sawIncomplete = true
+		} else if sawIncomplete && !completedSent && event == tracker.None {
+			event = tracker.Completed
+		}
+		if event == tracker.Completed {
+			completedSent = true
+		}
+
+		interval := w.announce(event)
+		event = tracker.None
+		started = true
+
+		var completed <-chan struct{}
+		if !completedSent && sawIncomplete {
+			completed = w.t.Complete().On()
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-w.stopChan:
+			timer.Stop()
+			if started {
+				w.announce(tracker.Stopped)
+			}
+			return
+		case <-w.t.Closed():
+			timer.Stop()
+			w.manager.removeWorker(w)
+			return
+		case <-w.reannounce:
+		case <-completed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// announce выполняет один анонс и возвращает паузу до следующего
+func (w *trackerWorker) announce(event tracker.AnnounceEvent) time.Duration {
+	w.mu.Lock()
+	w.status = TrackerUpdating
+	w.mu.Unlock()
+
+	stats := w.t.Stats()
+	req := tracker.AnnounceRequest{
+		InfoHash:   w.t.InfoHash(),
+		PeerId:     w.manager.cl.PeerID(),
+		Downloaded: stats.BytesReadUsefulData.Int64(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Left:       w.bytesLeft(),
+		Event:      event,
+		Key:        w.manager.key,
+		NumWant:    announceNumWant,
+		Port:       uint16(w.manager.cl.LocalPort()),
+	}
+	timeout := tracker.DefaultTrackerAnnounceTimeout
+	if event == tracker.Stopped {
+		req.NumWant = 0
+		timeout = stoppedAnnounceTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	announce := tracker.Announce{
+		TrackerUrl: w.url,
+		Request:    req,
+		HttpProxy:  w.manager.httpProxy,
+		Context:    ctx,
+	}
+	var res tracker.AnnounceResponse
+	var err error
+	switch {
+	case strings.HasPrefix(w.url, "ws://"), strings.HasPrefix(w.url, "wss://"):
+		err = errWebTorrentTracker
+	case !w.manager.udpAllowed && strings.HasPrefix(w.url, "udp"):
+		err = errUDPTrackerProxied
+	default:
+		res, err = announce.Do()
+	}
+
+	now := time.Now()
+	interval := errorAnnounceInterval
+	if err == nil {
+		interval = time.Duration(res.Interval) * time.Second
+		if interval < minAnnounceInterval {
+			interval = minAnnounceInterval
+		}
+		if event != tracker.Stopped {
+			peers := peersFromTracker(res.Peers)
+			if w.manager.blocklist != nil {
+				peers = w.manager.blocklist.filterPeers(w.t.InfoHash(), peers)
+			}
+			w.t.AddPeers(peers)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastAnnounce = now
+	w.nextAnnounce = now.Add(interval)
+	w.err = err
+	if err != nil {
+		w.status = TrackerError
+	} else {
+		w.status = TrackerWorking
+		w.peers = len(res.Peers)
+		w.seeders = int(res.Seeders)
+		w.leechers = int(res.Leechers)
+	}
+
+	return interval
+}
+
+// bytesLeft возвращает остаток загрузки или -1, пока метаданные неизвестны
+func (w *trackerWorker) bytesLeft() int64 {
+	if w.t.Info() == nil {
+		return -1
+	}
+	return w.t.BytesMissing()
+}
+
+func (w *trackerWorker) setTier(tier int) {
+	w.mu.Lock()
+	w.tier = tier
+	w.mu.Unlock()
+}
+
+// setStopped приостанавливает или возобновляет анонсы и будит worker, если состояние изменилось
+func (w *trackerWorker) setStopped(stopped bool) {
+	w.mu.Lock()
+	changed := w.stopped != stopped
+	w.stopped = stopped
+	w.mu.Unlock()
+
+	if changed {
+		select {
+		case w.reannounce <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *trackerWorker) isStopped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.stopped
+}
+
+// markStopped показывает в статусе, что анонсы приостановлены
+func (w *trackerWorker) markStopped() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status = TrackerStopped
+	w.peers = 0
+	w.seeders = 0
+	w.leechers = 0
+	w.nextAnnounce = time.Time{}
+}
+
+func (w *trackerWorker) snapshot() TrackerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := TrackerStatus{
+		URL:      w.url,
+		Tier:     w.tier,
+		Status:   w.status,
+		Peers:    w.peers,
+		Seeders:  w.seeders,
+		Leechers: w.leechers,
+	}
+	if !w.lastAnnounce.IsZero() {
+		last := w.lastAnnounce
+		status.LastAnnounce = &last
+	}
+	if !w.nextAnnounce.IsZero() {
+		next := w.nextAnnounce
+		status.NextAnnounce = &next
+	}
+	if w.err != nil {
+		status.Error = w.err.Error()
+	}
+	return status
+}
+
+func (w *trackerWorker) stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+}
+
+// peersFromTracker преобразует пиров из ответа трекера для anacrolix
+func peersFromTracker(peers []tracker.Peer) []torrent.PeerInfo {
+	result := make([]torrent.PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		info := torrent.PeerInfo{
+			Addr:   &net.TCPAddr{IP: p.IP, Port: p.Port},
+			Source: torrent.PeerSourceTracker,
+		}
+		copy(info.Id[:], p.ID)
+		result = append(result, info)
+	}
+	return result
+}
+
+// reannounce немедленно повторяет анонсы торрента на все его трекеры
+func (tm *trackerManager) reannounce(hash metainfo.Hash) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for _, w := range tm.torrents[hash] {
+		select {
+		case w.reannounce <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ErrInvalidTrackerURL is returned for tracker URLs that can't be announced to.
+var ErrInvalidTrackerURL = errors.New("invalid tracker URL")
+
+// ValidateTrackerURL checks that a tracker URL uses a supported scheme and has a host.
+func ValidateTrackerURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", rawURL, ErrInvalidTrackerURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "udp":
+	default:
+		return fmt.Errorf("%s: unsupported scheme %q: %w", rawURL, u.Scheme, ErrInvalidTrackerURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s: missing host: %w", rawURL, ErrInvalidTrackerURL)
+	}
+	return nil
+}
+
+// Trackers returns the trackers of a torrent with their announce status.
+func (c *Client) Trackers(infoHash string) ([]TrackerStatus, error) {
+	hash := metainfo.NewHashFromHex(infoHash)
+	if _, ok := c.tClient.Torrent(hash); !ok {
+		return nil, fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	return c.trackers.statuses(hash), nil
+}
+
+// EditTrackers adds trackers to a torrent in a new tier and removes others from all tiers.
+// Trackers that are both added and removed are removed.
+func (c *Client) EditTrackers(infoHash string, add, remove []string) error {
+	hash := metainfo.NewHashFromHex(infoHash)
+	t, ok := c.tClient.Torrent(hash)
+	if !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+
+	removed := make(map[string]struct{}, len(remove))
+	for _, u := range remove {
+		removed[u] = struct{}{}
+	}
+	present := make(map[string]struct{})
+	var tiers [][]string
+	mi := t.Metainfo()
+	for _, tier := range mi.UpvertedAnnounceList() {
+		var kept []string
+		for _, u := range tier {
+			if _, ok := removed[u]; ok || u == "" {
+				continue
+			}
+			present[u] = struct{}{}
+			kept = append(kept, u)
+		}
+		if len(kept) > 0 {
+			tiers = append(tiers, kept)
+		}
+	}
+
+	var added []string
+	for _, u := range add {
+		_, isRemoved := removed[u]
+		_, isPresent := present[u]
+		if !isRemoved && !isPresent {
+			present[u] = struct{}{}
+			added = append(added, u)
+		}
+	}
+	if len(added) > 0 {
+		tiers = append(tiers, added)
+	}
+
+	t.ModifyTrackers(tiers)
+	// Сверяем сразу, чтобы новые трекеры появились в статусе без ожидания очередной сверки
+	c.trackers.sync()
+	return nil
+}
+
+// Reannounce announces a torrent to all of its trackers right away.
+func (c *Client) Reannounce(infoHash string) error {
+	hash := metainfo.NewHashFromHex(infoHash)
+	if _, ok := c.tClient.Torrent(hash); !ok {
+		return fmt.Errorf("torrent with infohash %s not found in client", infoHash)
+	}
+	c.trackers.reannounce(hash)
+	return nil
+}
+
+// addExtraTrackers добавляет глобальные дополнительные трекеры последним уровнем
+func (c *Client) addExtraTrackers(t *torrent.Torrent) {
+	if len(c.network.ExtraTrackers) == 0 {
+		return
+	}
+	mi := t.Metainfo()
+	tiers := make([][]string, len(mi.UpvertedAnnounceList())+1)
+	tiers[len(tiers)-1] = c.network.ExtraTrackers
+	t.AddTrackers(tiers)
+}
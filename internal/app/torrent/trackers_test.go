@@ -0,0 +1,98 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const testTrackerURL = "http://127.0.0.1:1/announce"
+
+// newTestTorrentClient запускает клиент anacrolix без сети и DHT с хранилищем во временной папке
+func newTestTorrentClient(t *testing.T) *torrent.Client {
+	t.Helper()
+	dir := t.TempDir()
+	config := torrent.NewDefaultClientConfig()
+	config.DataDir = dir
+	config.DefaultStorage = storage.NewFile(dir)
+	config.ListenPort = 0
+	config.NoDHT = true
+	config.DisableTrackers = true
+	config.NoDefaultPortForwarding = true
+
+	cl, err := torrent.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+// testMetaInfo возвращает метаданные торрента из одного байта с одним трекером
+func testMetaInfo(t *testing.T) *metainfo.MetaInfo {
+	t.Helper()
+	infoBytes, err := bencode.Marshal(metainfo.Info{
+		Name:        "test",
+		PieceLength: 16 << 10,
+		Length:      1,
+		Pieces:      make([]byte, 20),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &metainfo.MetaInfo{InfoBytes: infoBytes, AnnounceList: [][]string{{testTrackerURL}}}
+}
+
+func (tm *trackerManager) worker(hash metainfo.Hash, url string) *trackerWorker {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.torrents[hash][url]
+}
+
+func TestTrackerSyncReplacesWorkersOfReaddedTorrent(t *testing.T) {
+	cl := newTestTorrentClient(t)
+	// Приостановленные торренты не анонсируются, тест не обращается к трекеру
+	tm := newTrackerManager(cl, func(metainfo.Hash) bool { return true }, nil, true, nil)
+	t.Cleanup(tm.stop)
+
+	mi := testMetaInfo(t)
+	first, err := cl.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := first.InfoHash()
+
+	tm.sync()
+	old := tm.worker(hash, testTrackerURL)
+	if old == nil || old.t != first {
+		t.Fatalf("worker after the first sync = %+v, want one for the added torrent", old)
+	}
+
+	// Как при переносе хранилища: торрент удаляется и сразу добавляется заново
+	first.Drop()
+	second, err := cl.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.sync()
+
+	current := tm.worker(hash, testTrackerURL)
+	if current == nil || current == old || current.t != second {
+		t.Fatalf("worker after re-adding = %+v, want a new one for the re-added torrent", current)
+	}
+
+	// Worker удалённого торрента убирает себя сам, не дожидаясь следующей сверки
+	second.Drop()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tm.statuses(hash)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("worker of the dropped torrent is still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
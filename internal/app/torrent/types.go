@@ -2,6 +2,10 @@ package torrent
 
 import (
 	"GoFlix/internal/app/media"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -13,6 +17,8 @@ const (
 	StateQueued
 	StateCompleted
 	StatePaused
+	StateFetchingMetadata // Ожидание метаданных магнет-ссылки
+	StateMetadataFailed   // Метаданные не получены за отведённое время
 )
 
 type ConvertingState int
@@ -25,12 +31,154 @@ const (
 	StateConvertingError                         // Ошибка при конвертации
 )
 
+// FilePriority приоритет загрузки файла внутри торрента
+type FilePriority string
+
+const (
+	FilePrioritySkip   FilePriority = "skip"   // Файл не загружается
+	FilePriorityNormal FilePriority = "normal" // Обычный приоритет
+	FilePriorityHigh   FilePriority = "high"   // Загружается в первую очередь
+)
+
+// Valid проверяет, что приоритет имеет допустимое значение
+func (p FilePriority) Valid() bool {
+	switch p {
+	case FilePrioritySkip, FilePriorityNormal, FilePriorityHigh:
+		return true
+	}
+	return false
+}
+
+// ConversionProfile способ конвертации видео в HLS
+type ConversionProfile string
+
+const (
+	// ConversionTranscode перекодирует видео в H.264 с параметрами по разрешению, используется по умолчанию
+	ConversionTranscode ConversionProfile = "transcode"
+	// ConversionCopy только перепаковывает потоки в HLS без перекодирования
+	ConversionCopy ConversionProfile = "copy"
+	// ConversionAdaptive создаёт несколько качеств от 360p до 1080p с мастер-плейлистом
+	ConversionAdaptive ConversionProfile = "adaptive"
+)
+
+// Valid проверяет, что профиль имеет допустимое значение
+func (p ConversionProfile) Valid() bool {
+	switch p {
+	case ConversionTranscode, ConversionCopy, ConversionAdaptive:
+		return true
+	}
+	return false
+}
+
+// playlist возвращает путь к плейлисту, который профиль создаёт для видео
+func (p ConversionProfile) playlist(video string) string {
+	withoutExt := strings.TrimSuffix(video, filepath.Ext(video))
+	switch p {
+	case ConversionCopy:
+		return withoutExt + ".m3u8"
+	case ConversionAdaptive:
+		return filepath.Join(withoutExt, "master.m3u8")
+	default:
+		return filepath.Join(withoutExt, "playlist.m3u8")
+	}
+}
+
+// outputs возвращает пути, которые профиль создаёт при конвертации видео: плейлист и папку сегментов
+func (p ConversionProfile) outputs(video string) []string {
+	withoutExt := strings.TrimSuffix(video, filepath.Ext(video))
+	if p == ConversionCopy {
+		return []string{withoutExt, withoutExt + ".m3u8"}
+	}
+	// Плейлисты остальных профилей лежат в папке сегментов
+	return []string{withoutExt}
+}
+
+// maxLabelLength ограничивает длину категории и тега
+const maxLabelLength = 64
+
+// RateLimits ограничения скорости в байтах в секунду, 0 — без ограничения
+type RateLimits struct {
+	Download int64 `json:"download"`
+	Upload   int64 `json:"upload"`
+}
+
+// Validate проверяет, что ограничения не отрицательные
+func (l RateLimits) Validate() error {
+	if l.Download < 0 || l.Upload < 0 {
+		return fmt.Errorf("rate limits must not be negative")
+	}
+	return nil
+}
+
+// AddOptions параметры добавления торрента
+type AddOptions struct {
+	// FilePriorities задаёт приоритеты файлов по пути внутри торрента, остальные файлы загружаются с обычным приоритетом
+	FilePriorities map[string]FilePriority `json:"files,omitempty"`
+	// DownloadMode порядок загрузки частей
+	DownloadMode DownloadMode `json:"downloadMode"`
+	// SavePath папка для данных торрента внутри одной из папок сохранения, по умолчанию папка торрентов
+	SavePath string `json:"savePath,omitempty"`
+	// AutoConvert включает или отключает конвертацию после загрузки, по умолчанию включена
+	AutoConvert *bool `json:"autoConvert,omitempty"`
+	// ConversionProfile способ конвертации, по умолчанию transcode
+	ConversionProfile ConversionProfile `json:"conversionProfile,omitempty"`
+	// Paused добавляет торрент приостановленным: метаданные загружаются, данные — нет
+	Paused bool `json:"paused,omitempty"`
+	// Category и Tags метки для группировки торрентов. Пустые значения оставляют сохранённые
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Cookie заголовок Cookie для загрузки .torrent файла по http(s), например с приватного трекера. Не сохраняется.
+	Cookie string `json:"cookie,omitempty"`
+}
+
+// Validate проверяет параметры добавления
+func (o AddOptions) Validate() error {
+	if err := validateFilePriorities(o.FilePriorities); err != nil {
+		return err
+	}
+	if o.ConversionProfile != "" && !o.ConversionProfile.Valid() {
+		return fmt.Errorf("invalid conversion profile %q", o.ConversionProfile)
+	}
+	if len(strings.TrimSpace(o.Category)) > maxLabelLength {
+		return fmt.Errorf("category is longer than %d bytes", maxLabelLength)
+	}
+	for _, tag := range o.Tags {
+		if len(strings.TrimSpace(tag)) > maxLabelLength {
+			return fmt.Errorf("tag %q is longer than %d bytes", tag, maxLabelLength)
+		}
+	}
+	return nil
+}
+
+// normalizeTags убирает пробелы по краям, пустые теги и повторы
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func validateFilePriorities(priorities map[string]FilePriority) error {
+	for path, prio := range priorities {
+		if !prio.Valid() {
+			return fmt.Errorf("invalid priority %q for file %s", prio, path)
+		}
+	}
+	return nil
+}
+
 // Torrent представляет информация о торренте
 type Torrent struct {
 	InfoHash           string          `json:"infoHash"`
 	Name               string          `json:"name"`
 	Magnet             string          `json:"magnet"`
 	Size               int64           `json:"size"`
+	SelectedSize       int64           `json:"selectedSize"`
+	SavePath           string          `json:"savePath,omitempty"`
 	Done               bool            `json:"done"`
 	State              State           `json:"state"`
 	ConvertingState    ConvertingState `json:"convertingState"`
@@ -39,7 +187,39 @@ type Torrent struct {
 	ConvertedAt        *time.Time      `json:"convertedAt,omitempty"`
 	LastChecked        time.Time       `json:"lastChecked"`
 	DownloadedPercent  float32         `json:"downloadedPercent"`
+	Error              string          `json:"error,omitempty"`
 	VideoFiles         []VideoFile     `json:"videoFiles,omitempty"`
+	// FilePriorities хранит приоритеты файлов, отличные от обычного
+	FilePriorities map[string]FilePriority `json:"filePriorities,omitempty"`
+	// Limits собственные ограничения скорости торрента
+	Limits RateLimits `json:"limits"`
+	// EffectiveLimits действующие ограничения с учётом глобальных, есть только у активных торрентов
+	EffectiveLimits *RateLimits `json:"effectiveLimits,omitempty"`
+	// QueuePosition место в очереди загрузки, меньшие значения запускаются раньше
+	QueuePosition int `json:"queuePosition"`
+	// ForceStart запускает торрент в обход очереди
+	ForceStart bool `json:"forceStart,omitempty"`
+	// DownloadMode порядок загрузки частей
+	DownloadMode DownloadMode `json:"downloadMode"`
+	// AutoConvert false отключает конвертацию после загрузки
+	AutoConvert *bool `json:"autoConvert,omitempty"`
+	// ConversionProfile способ конвертации, пустой — transcode
+	ConversionProfile ConversionProfile `json:"conversionProfile,omitempty"`
+	// ConvertedProfile профиль, которым торрент был конвертирован, от него зависит путь к плейлистам
+	ConvertedProfile ConversionProfile `json:"convertedProfile,omitempty"`
+	Category         string            `json:"category,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	// AddedTrackers и RemovedTrackers трекеры, добавленные и удалённые пользователем,
+	// применяются заново при каждом добавлении торрента в клиент
+	AddedTrackers   []string `json:"addedTrackers,omitempty"`
+	RemovedTrackers []string `json:"removedTrackers,omitempty"`
+	// Stats статистика обмена, есть только у активных торрентов
+	Stats *TransferStats `json:"stats,omitempty"`
+}
+
+// hasConversionOutput сообщает, что торрент конвертировался и рядом с его видео могут лежать результаты конвертации
+func (t *Torrent) hasConversionOutput() bool {
+	return t != nil && (t.ConvertedProfile != "" || t.ConvertingState == StateConverted)
 }
 
 // VideoFile представляет информацию о видеофайле
@@ -47,4 +227,28 @@ type VideoFile struct {
 	Path      string           `json:"path"`
 	VideoInfo *media.VideoInfo `json:"videoInfo"`
 	Error     error            `json:"error"`
+	// Playlist путь к плейлисту HLS, если видео конвертировано
+	Playlist string `json:"playlist,omitempty"`
+}
+
+// TorrentFile представляет файл внутри торрента
+type TorrentFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Completed загруженные и проверенные байты файла
+	Completed int64        `json:"completed"`
+	Progress  float32      `json:"progress"`
+	Priority  FilePriority `json:"priority"`
+	IsVideo   bool         `json:"isVideo"`
+	// HLSExists есть ли результат конвертации видео в HLS
+	HLSExists bool `json:"hlsExists"`
+	// Playlist путь к плейлисту HLS, если он есть
+	Playlist string `json:"playlist,omitempty"`
+}
+
+// AddedTorrent результат добавления торрента из .torrent файла
+type AddedTorrent struct {
+	InfoHash string        `json:"infoHash"`
+	Name     string        `json:"name"`
+	Files    []TorrentFile `json:"files"`
 }
@@ -1,8 +1,44 @@
 package torrent
 
+import "github.com/anacrolix/torrent"
+
 func getPercent(n, total int64) float32 {
 	if total == 0 {
 		return float32(0)
 	}
 	return float32(int(float64(10000)*(float64(n)/float64(total)))) / 100
 }
+
+// selectedBytes возвращает размер выбранных для загрузки файлов и сколько из них уже загружено
+func selectedBytes(t *torrent.Torrent) (selected, completed int64) {
+	for _, f := range t.Files() {
+		if f.Priority() == torrent.PiecePriorityNone {
+			continue
+		}
+		selected += f.Length()
+		completed += f.BytesCompleted()
+	}
+	return selected, completed
+}
+
+func toPiecePriority(p FilePriority) torrent.PiecePriority {
+	switch p {
+	case FilePrioritySkip:
+		return torrent.PiecePriorityNone
+	case FilePriorityHigh:
+		return torrent.PiecePriorityHigh
+	default:
+		return torrent.PiecePriorityNormal
+	}
+}
+
+func fromPiecePriority(p torrent.PiecePriority) FilePriority {
+	switch {
+	case p == torrent.PiecePriorityNone:
+		return FilePrioritySkip
+	case p >= torrent.PiecePriorityHigh:
+		return FilePriorityHigh
+	default:
+		return FilePriorityNormal
+	}
+}
@@ -0,0 +1,275 @@
+package torrent
+
+import (
+	"GoFlix/internal/pkg/filehelpers"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// watchDoneDir и watchFailedDir подпапки для обработанных файлов, они не просматриваются
+	watchDoneDir   = "done"
+	watchFailedDir = "failed"
+	// watchDefaultsFile файл с параметрами добавления для папки и её подпапок
+	watchDefaultsFile = "watch.json"
+	// watchSettleTime файлы, изменённые позже, могут ещё записываться и пропускаются до следующего обхода
+	watchSettleTime = 2 * time.Second
+)
+
+// WatchDefaults параметры добавления торрентов из папки наблюдения
+type WatchDefaults struct {
+	SavePath    string `json:"savePath,omitempty"`
+	AutoConvert *bool  `json:"autoConvert,omitempty"`
+}
+
+// merge накладывает заданные в child значения на родительские
+func (d WatchDefaults) merge(child WatchDefaults) WatchDefaults {
+	if child.SavePath != "" {
+		d.SavePath = child.SavePath
+	}
+	if child.AutoConvert != nil {
+		d.AutoConvert = child.AutoConvert
+	}
+	return d
+}
+
+// WatchFolder периодически добавляет торренты из файлов, появившихся в папке наблюдения
+type WatchFolder struct {
+	service  *Service
+	dir      string
+	interval time.Duration
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewWatchFolder(service *Service, dir string, interval time.Duration) *WatchFolder {
+	return &WatchFolder{
+		service:  service,
+		dir:      dir,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start создаёт папку наблюдения и начинает её обход
+func (w *WatchFolder) Start() error {
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		w.scan()
+		for {
+			select {
+			case <-w.stopChan:
+				return
+			case <-ticker.C:
+				w.scan()
+			}
+		}
+	}()
+
+	log.Printf("[watch] Watching %s every %s", w.dir, w.interval)
+	return nil
+}
+
+// Stop останавливает обход и ждёт окончания текущего
+func (w *WatchFolder) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+	w.wg.Wait()
+}
+
+// scan обходит папку наблюдения и её подпапки
+func (w *WatchFolder) scan() {
+	defaults := make(map[string]WatchDefaults)
+
+	err := filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("[watch] Failed to read %s: %v", path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != w.dir && (d.Name() == watchDoneDir || d.Name() == watchFailedDir || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			parent := defaults[filepath.Dir(path)]
+			own, err := loadWatchDefaults(path)
+			if err != nil {
+				log.Printf("[watch] Ignoring %s: %v", filepath.Join(path, watchDefaultsFile), err)
+			}
+			defaults[path] = parent.merge(own)
+			return nil
+		}
+
+		if !isWatchFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || time.Since(info.ModTime()) < watchSettleTime {
+			return nil
+		}
+
+		select {
+		case <-w.stopChan:
+			return filepath.SkipAll
+		default:
+		}
+
+		w.importFile(path, defaults[filepath.Dir(path)])
+		return nil
+	})
+	if err != nil {
+		log.Printf("[watch] Failed to scan %s: %v", w.dir, err)
+	}
+}
+
+// importFile добавляет торренты из файла и переносит его в подпапку done или failed
+func (w *WatchFolder) importFile(path string, defaults WatchDefaults) {
+	opts := AddOptions{SavePath: defaults.SavePath, AutoConvert: defaults.AutoConvert}
+
+	var hashes []string
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".torrent") {
+		hashes, err = w.importTorrentFile(path, opts)
+	} else {
+		hashes, err = w.importMagnets(path, opts)
+	}
+
+	target := watchDoneDir
+	if err != nil {
+		target = watchFailedDir
+		log.Printf("[watch] Failed to import %s: %v", path, err)
+		w.service.stateManager.SendEvent(Event{
+			Type:      "watch_import_failed",
+			Torrent:   &Torrent{Name: filepath.Base(path), Error: err.Error()},
+			Timestamp: time.Now(),
+		})
+	}
+
+	for _, hash := range hashes {
+		torrent, getErr := w.service.stateManager.GetTorrent(hash)
+		if getErr != nil {
+			torrent = &Torrent{InfoHash: hash}
+		}
+		log.Printf("[watch] Imported %s from %s", hash, path)
+		w.service.stateManager.SendEvent(Event{
+			Type:      "watch_imported",
+			Torrent:   torrent,
+			Timestamp: time.Now(),
+		})
+	}
+
+	if moveErr := moveToSubdir(path, target); moveErr != nil {
+		log.Printf("[watch] Failed to move %s to %s: %v", path, target, moveErr)
+	}
+}
+
+func (w *WatchFolder) importTorrentFile(path string, opts AddOptions) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer filehelpers.CloseFile(file)
+
+	added, err := w.service.AddTorrentFile(file, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{added.InfoHash}, nil
+}
+
+// importMagnets добавляет все магнет-ссылки из текстового файла, по одной на строку
+func (w *WatchFolder) importMagnets(path string, opts AddOptions) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer filehelpers.CloseFile(file)
+
+	var hashes []string
+	var errs []error
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "magnet:") {
+			continue
+		}
+		hash, err := w.service.AddTorrent(line, opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(hashes) == 0 && len(errs) == 0 {
+		errs = append(errs, errors.New("no magnet links found"))
+	}
+	return hashes, errors.Join(errs...)
+}
+
+// isWatchFile сообщает, может ли файл содержать торренты
+func isWatchFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".torrent", ".magnet", ".txt":
+		return true
+	}
+	return false
+}
+
+// loadWatchDefaults читает параметры папки, отсутствие файла не считается ошибкой
+func loadWatchDefaults(dir string) (WatchDefaults, error) {
+	var defaults WatchDefaults
+	data, err := os.ReadFile(filepath.Join(dir, watchDefaultsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaults, nil
+	}
+	if err != nil {
+		return defaults, err
+	}
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		return WatchDefaults{}, err
+	}
+	return defaults, nil
+}
+
+// moveToSubdir переносит файл в подпапку рядом с ним, не перезаписывая файлы с тем же именем
+func moveToSubdir(path, subdir string) error {
+	dir := filepath.Join(filepath.Dir(path), subdir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+	}
+	return os.Rename(path, target)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// GetBlocklistHandler обрабатывает GET /blocklist
+func GetBlocklistHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := service.BlocklistStatus()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// ReloadBlocklistHandler обрабатывает POST /blocklist/reload
+func ReloadBlocklistHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := service.ReloadBlocklist()
+		if err != nil {
+			log.Printf("[api] Failed to reload blocklist: %v", err)
+			code := http.StatusInternalServerError
+			if errors.Is(err, torrent.ErrNoBlocklist) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
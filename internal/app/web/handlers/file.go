@@ -69,7 +69,7 @@ func VideoHandler(cfg *configs.Config) http.HandlerFunc {
 			return
 		}
 
-		safePath, err := filesystem.BuildSafePath(cfg.TorrentsDir, filePath)
+		safePath, err := resolveStoragePath(cfg, filePath)
 		if err != nil {
 			http.Error(w, "invalid path", http.StatusForbidden)
 			return
@@ -122,3 +122,27 @@ func VideoHandler(cfg *configs.Config) http.HandlerFunc {
 		}
 	}
 }
+
+// resolveStoragePath ищет файл в папке торрентов и в дополнительных папках сохранения.
+// Если файл нигде не найден, возвращается путь внутри первой подходящей папки.
+func resolveStoragePath(cfg *configs.Config, filePath string) (string, error) {
+	var candidate string
+	var lastErr error
+	for _, root := range cfg.StorageRoots() {
+		safePath, err := filesystem.BuildSafePath(root, filePath)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := os.Stat(safePath); err == nil {
+			return safePath, nil
+		}
+		if candidate == "" {
+			candidate = safePath
+		}
+	}
+	if candidate == "" {
+		return "", lastErr
+	}
+	return candidate, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetGlobalLimitsHandler обрабатывает GET /limits
+func GetGlobalLimitsHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(service.GlobalLimits()); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// GetClientSettingsHandler обрабатывает GET /client/settings
+func GetClientSettingsHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(service.ClientSettings()); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// SetGlobalLimitsHandler обрабатывает PUT /limits
+func SetGlobalLimitsHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limits torrent.RateLimits
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.SetGlobalLimits(limits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// SetTorrentLimitsHandler обрабатывает PUT /{hash}/limits
+func SetTorrentLimitsHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		var limits torrent.RateLimits
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.SetTorrentLimits(hash, limits); err != nil {
+			log.Printf("[api] Failed to set torrent limits: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
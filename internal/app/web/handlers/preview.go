@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// previewWait сколько запрос предпросмотра ждёт метаданные магнет-ссылки, дальше их можно запрашивать через GET
+const previewWait = 20 * time.Second
+
+type previewRequest struct {
+	Source string `json:"source"`
+	Cookie string `json:"cookie,omitempty"`
+}
+
+// PreviewTorrentHandler обрабатывает POST /torrents/preview.
+// Принимает {"source": ...} с магнет-ссылкой или http(s) адресом, либо .torrent файл как при добавлении.
+// Отвечает 200, если метаданные получены, и 202, если они ещё загружаются.
+func PreviewTorrentHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var preview *torrent.TorrentPreview
+		var err error
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "multipart/form-data":
+			r.Body = http.MaxBytesReader(w, r.Body, torrent.MaxTorrentFileSize+1<<20)
+			file, _, ferr := r.FormFile("file")
+			if ferr != nil {
+				http.Error(w, "Missing torrent file", http.StatusBadRequest)
+				return
+			}
+			defer func() {
+				if err := file.Close(); err != nil {
+					log.Printf("[api] Failed to close uploaded file: %v", err)
+				}
+				if err := r.MultipartForm.RemoveAll(); err != nil {
+					log.Printf("[api] Failed to remove multipart temp files: %v", err)
+				}
+			}()
+			preview, err = service.PreviewTorrentFile(file)
+		case "application/x-bittorrent":
+			r.Body = http.MaxBytesReader(w, r.Body, torrent.MaxTorrentFileSize)
+			preview, err = service.PreviewTorrentFile(r.Body)
+		default:
+			var req previewRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+			preview, err = service.PreviewTorrent(r.Context(), req.Source, req.Cookie)
+		}
+		if err != nil {
+			log.Printf("[api] Failed to preview torrent: %v", err)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), addErrorStatus(err))
+			return
+		}
+
+		if !preview.Ready && preview.Error == "" {
+			ctx, cancel := context.WithTimeout(r.Context(), previewWait)
+			defer cancel()
+			if preview, err = service.WaitForPreview(ctx, preview.InfoHash); err != nil {
+				writePreviewError(w, err)
+				return
+			}
+		}
+
+		status := http.StatusOK
+		if !preview.Ready && preview.Error == "" {
+			status = http.StatusAccepted
+		}
+		writePreviewJSON(w, status, preview)
+	}
+}
+
+// GetPreviewHandler обрабатывает GET /torrents/preview/{hash}
+func GetPreviewHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		preview, err := service.GetPreview(chi.URLParam(r, "hash"))
+		if err != nil {
+			writePreviewError(w, err)
+			return
+		}
+		writePreviewJSON(w, http.StatusOK, preview)
+	}
+}
+
+// ConfirmPreviewHandler обрабатывает POST /torrents/preview/{hash}/confirm, параметры добавления передаются в теле запроса
+func ConfirmPreviewHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts torrent.AddOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		added, err := service.ConfirmPreview(chi.URLParam(r, "hash"), opts)
+		if err != nil {
+			writePreviewError(w, err)
+			return
+		}
+		writePreviewJSON(w, http.StatusOK, added)
+	}
+}
+
+// CancelPreviewHandler обрабатывает DELETE /torrents/preview/{hash}
+func CancelPreviewHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := service.CancelPreview(chi.URLParam(r, "hash")); err != nil {
+			writePreviewError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writePreviewError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, torrent.ErrPreviewNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, torrent.ErrPreviewNotReady), errors.Is(err, torrent.ErrTorrentExists):
+		status = http.StatusConflict
+	case errors.Is(err, torrent.ErrSavePathNotAllowed):
+		status = http.StatusForbidden
+	default:
+		log.Printf("[api] Preview request failed: %v", err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writePreviewJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Обрабатываем ошибку Encode
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[api] Client disconnected before response: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type queueResponse struct {
+	Limits   torrent.QueueLimits `json:"limits"`
+	Torrents []queueEntry        `json:"torrents"`
+}
+
+type queueEntry struct {
+	InfoHash      string        `json:"infoHash"`
+	Name          string        `json:"name"`
+	State         torrent.State `json:"state"`
+	QueuePosition int           `json:"queuePosition"`
+	ForceStart    bool          `json:"forceStart"`
+}
+
+// GetQueueHandler обрабатывает GET /queue
+func GetQueueHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ordered := service.GetQueue()
+		resp := queueResponse{
+			Limits:   service.QueueLimits(),
+			Torrents: make([]queueEntry, 0, len(ordered)),
+		}
+		for _, t := range ordered {
+			resp.Torrents = append(resp.Torrents, queueEntry{
+				InfoHash:      t.InfoHash,
+				Name:          t.Name,
+				State:         t.State,
+				QueuePosition: t.QueuePosition,
+				ForceStart:    t.ForceStart,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// MoveInQueueHandler обрабатывает POST /{hash}/queue/up и POST /{hash}/queue/down
+func MoveInQueueHandler(service *torrent.Service, delta int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.MoveInQueue(hash, delta); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ForceStartHandler обрабатывает POST и DELETE /{hash}/force-start
+func ForceStartHandler(service *torrent.Service, force bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.SetForceStart(hash, force); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetFeedsHandler обрабатывает GET /rss/feeds
+func GetFeedsHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeFeedJSON(w, http.StatusOK, feeds.Feeds())
+	}
+}
+
+// GetFeedHandler обрабатывает GET /rss/feeds/{id}
+func GetFeedHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feed, err := feeds.Feed(chi.URLParam(r, "id"))
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		writeFeedJSON(w, http.StatusOK, feed)
+	}
+}
+
+// AddFeedHandler обрабатывает POST /rss/feeds
+func AddFeedHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req torrent.Feed
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		feed, err := feeds.AddFeed(req)
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		writeFeedJSON(w, http.StatusCreated, feed)
+	}
+}
+
+// UpdateFeedHandler обрабатывает PUT /rss/feeds/{id}
+func UpdateFeedHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req torrent.Feed
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		feed, err := feeds.UpdateFeed(chi.URLParam(r, "id"), req)
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		writeFeedJSON(w, http.StatusOK, feed)
+	}
+}
+
+// DeleteFeedHandler обрабатывает DELETE /rss/feeds/{id}
+func DeleteFeedHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := feeds.DeleteFeed(chi.URLParam(r, "id")); err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RefreshFeedHandler обрабатывает POST /rss/feeds/{id}/refresh
+func RefreshFeedHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feed, err := feeds.RefreshFeed(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		// Ошибка загрузки ленты видна в lastError
+		writeFeedJSON(w, http.StatusOK, feed)
+	}
+}
+
+// TestFeedRuleHandler обрабатывает POST /rss/feeds/{id}/test, правило передаётся в теле запроса
+func TestFeedRuleHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rule torrent.FeedRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		matches, err := feeds.TestRule(r.Context(), chi.URLParam(r, "id"), rule)
+		if err != nil {
+			if errors.Is(err, torrent.ErrFeedNotFound) || errors.Is(err, torrent.ErrInvalidFeed) {
+				writeFeedError(w, err)
+				return
+			}
+			// Не удалось загрузить или разобрать ленту
+			log.Printf("[api] Failed to test feed rule: %v", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeFeedJSON(w, http.StatusOK, matches)
+	}
+}
+
+// AddFeedRuleHandler обрабатывает POST /rss/feeds/{id}/rules
+func AddFeedRuleHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req torrent.FeedRule
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		rule, err := feeds.AddRule(chi.URLParam(r, "id"), req)
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		writeFeedJSON(w, http.StatusCreated, rule)
+	}
+}
+
+// UpdateFeedRuleHandler обрабатывает PUT /rss/feeds/{id}/rules/{ruleID}
+func UpdateFeedRuleHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req torrent.FeedRule
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		rule, err := feeds.UpdateRule(chi.URLParam(r, "id"), chi.URLParam(r, "ruleID"), req)
+		if err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		writeFeedJSON(w, http.StatusOK, rule)
+	}
+}
+
+// DeleteFeedRuleHandler обрабатывает DELETE /rss/feeds/{id}/rules/{ruleID}
+func DeleteFeedRuleHandler(feeds *torrent.FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := feeds.DeleteRule(chi.URLParam(r, "id"), chi.URLParam(r, "ruleID")); err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeFeedError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, torrent.ErrFeedNotFound), errors.Is(err, torrent.ErrFeedRuleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, torrent.ErrInvalidFeed):
+		status = http.StatusBadRequest
+	case errors.Is(err, torrent.ErrSavePathNotAllowed):
+		status = http.StatusForbidden
+	default:
+		log.Printf("[api] Feed request failed: %v", err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeFeedJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Обрабатываем ошибку Encode
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[api] Client disconnected before response: %v", err)
+	}
+}
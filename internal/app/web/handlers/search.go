@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// SearchHandler обрабатывает GET /search?q=...&cat=...&indexer=...
+func SearchHandler(searcher *torrent.Searcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := torrent.SearchQuery{
+			Query:    r.URL.Query().Get("q"),
+			Category: r.URL.Query().Get("cat"),
+			Indexers: r.URL.Query()["indexer"],
+		}
+
+		response, err := searcher.Search(r.Context(), query)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, torrent.ErrInvalidSearch):
+				status = http.StatusBadRequest
+			case errors.Is(err, torrent.ErrNoIndexers):
+				status = http.StatusNotFound
+			case errors.Is(err, torrent.ErrIndexersFailed):
+				status = http.StatusBadGateway
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// GetIndexersHandler обрабатывает GET /search/indexers
+func GetIndexersHandler(searcher *torrent.Searcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(searcher.Indexers()); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
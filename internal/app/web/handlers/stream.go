@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// StreamTorrentFileHandler обрабатывает GET /{hash}/stream?path=<путь файла в торренте>.
+// Отдаёт файл активного торрента во время загрузки с поддержкой Range-запросов.
+func StreamTorrentFileHandler(service *torrent.Service) http.HandlerFunc {
+	// Go знает не все видеоформаты, регистрируем основные
+	mime.AddExtensionType(".mp4", "video/mp4")
+	mime.AddExtensionType(".m4v", "video/mp4")
+	mime.AddExtensionType(".mkv", "video/x-matroska")
+	mime.AddExtensionType(".webm", "video/webm")
+	mime.AddExtensionType(".avi", "video/x-msvideo")
+	mime.AddExtensionType(".mov", "video/quicktime")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		filePath := r.URL.Query().Get("path")
+		if filePath == "" {
+			http.Error(w, "no path specified", http.StatusBadRequest)
+			return
+		}
+
+		stream, err := service.OpenTorrentFile(r.Context(), hash, filePath)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		defer func() {
+			if err := stream.Close(); err != nil {
+				log.Printf("[stream] Error closing reader for %s: %v", stream.Name, err)
+			}
+		}()
+
+		// ServeContent сам обрабатывает Range, If-Range и HEAD
+		http.ServeContent(w, r, stream.Name, time.Time{}, stream)
+	}
+}
@@ -2,19 +2,53 @@ package handlers
 
 import (
 	"GoFlix/internal/app/torrent"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
+	"slices"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type addRequest struct {
 	Source string `json:"source"`
+	torrent.AddOptions
 }
 
+type filePrioritiesRequest struct {
+	Priorities map[string]torrent.FilePriority `json:"priorities"`
+}
+
+// AddTorrentHandler обрабатывает POST /torrents.
+// Принимает JSON {"source": ...}, multipart/form-data с полем "file" или тело application/x-bittorrent.
+// Параметры добавления передаются в JSON запроса или в поле "options" multipart-формы.
 func AddTorrentHandler(service *torrent.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		switch mediaType {
+		case "multipart/form-data":
+			addTorrentFromMultipart(service, w, r)
+			return
+		case "application/x-bittorrent":
+			// Тело запроса занято файлом, параметры добавления передаются в query параметре options
+			opts, err := parseAddOptions(r.URL.Query().Get("options"))
+			if err != nil {
+				http.Error(w, "Invalid options", http.StatusBadRequest)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, torrent.MaxTorrentFileSize)
+			addTorrentFromFile(service, w, r.Body, opts)
+			return
+		}
+
 		var req addRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Println(err)
@@ -22,11 +56,11 @@ func AddTorrentHandler(service *torrent.Service) http.HandlerFunc {
 			return
 		}
 
-		infoHash, err := service.AddTorrent(req.Source)
+		infoHash, err := service.AddTorrentContext(r.Context(), req.Source, req.AddOptions)
 
 		if err != nil {
 			log.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), addErrorStatus(err))
 			return
 		}
 
@@ -39,6 +73,89 @@ func AddTorrentHandler(service *torrent.Service) http.HandlerFunc {
 	}
 }
 
+// addErrorStatus выбирает HTTP статус для ошибки добавления торрента по источнику
+func addErrorStatus(err error) int {
+	var fetchErr *torrent.FetchError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &fetchErr):
+		// Источник недоступен или вернул не .torrent файл
+		return http.StatusBadGateway
+	case errors.Is(err, torrent.ErrSavePathNotAllowed):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// addTorrentFromMultipart добавляет торрент из поля "file" multipart-формы
+func addTorrentFromMultipart(service *torrent.Service, w http.ResponseWriter, r *http.Request) {
+	// Запас на заголовки и прочие поля формы
+	r.Body = http.MaxBytesReader(w, r.Body, torrent.MaxTorrentFileSize+1<<20)
+	if err := r.ParseMultipartForm(torrent.MaxTorrentFileSize); err != nil {
+		log.Printf("[api] Invalid multipart form: %v", err)
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if err := r.MultipartForm.RemoveAll(); err != nil {
+			log.Printf("[api] Failed to remove multipart temp files: %v", err)
+		}
+	}()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing torrent file", http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("[api] Failed to close uploaded file: %v", err)
+		}
+	}()
+
+	opts, err := parseAddOptions(r.FormValue("options"))
+	if err != nil {
+		http.Error(w, "Invalid options", http.StatusBadRequest)
+		return
+	}
+
+	addTorrentFromFile(service, w, file, opts)
+}
+
+// parseAddOptions разбирает параметры добавления в JSON, пустая строка означает параметры по умолчанию
+func parseAddOptions(raw string) (torrent.AddOptions, error) {
+	var opts torrent.AddOptions
+	if raw == "" {
+		return opts, nil
+	}
+	err := json.Unmarshal([]byte(raw), &opts)
+	return opts, err
+}
+
+// addTorrentFromFile разбирает .torrent файл и добавляет его в клиент
+func addTorrentFromFile(service *torrent.Service, w http.ResponseWriter, body io.Reader, opts torrent.AddOptions) {
+	added, err := service.AddTorrentFile(body, opts)
+	if err != nil {
+		log.Printf("[api] Failed to add torrent file: %v", err)
+		status := http.StatusInternalServerError
+		var maxBytesErr *http.MaxBytesError
+		if errors.Is(err, torrent.ErrInvalidTorrentFile) || errors.As(err, &maxBytesErr) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Обрабатываем ошибку Encode
+	if err := json.NewEncoder(w).Encode(added); err != nil {
+		log.Printf("[api] Client disconnected before response: %v", err)
+	}
+}
+
 func GetTorrentHandler(service *torrent.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		hash := chi.URLParam(r, "hash")
@@ -66,6 +183,18 @@ func GetTorrentsHandler(service *torrent.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		torrents := service.GetTorrents()
 
+		// Необязательный фильтр по категории и тегу
+		category, tag := r.URL.Query().Get("category"), r.URL.Query().Get("tag")
+		if category != "" || tag != "" {
+			filtered := make([]torrent.Torrent, 0, len(torrents))
+			for _, t := range torrents {
+				if (category == "" || t.Category == category) && (tag == "" || slices.Contains(t.Tags, tag)) {
+					filtered = append(filtered, t)
+				}
+			}
+			torrents = filtered
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 
 		// Обрабатываем ошибку Encode
@@ -122,16 +251,60 @@ func DeleteTorrentHandler(service *torrent.Service) http.HandlerFunc {
 			return
 		}
 
-		err := service.DeleteTorrent(hash)
+		opts, err := parseDeleteOptions(r)
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := service.DeleteTorrent(hash, opts)
+		if errors.Is(err, torrent.ErrPathOutsideDir) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil && result == nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err != nil {
+			// Торрент удалён, но часть файлов удалить не удалось
+			log.Printf("[api] Failed to delete some torrent data: %v", err)
+		}
 
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
 	}
 }
 
+// parseDeleteOptions читает параметры deleteData, deleteHls и deletePieceCompletion.
+// deleteData=all удаляет всё сразу.
+func parseDeleteOptions(r *http.Request) (torrent.DeleteOptions, error) {
+	query := r.URL.Query()
+	if query.Get("deleteData") == "all" {
+		return torrent.DeleteOptions{Data: true, HLS: true, PieceCompletion: true}, nil
+	}
+
+	var opts torrent.DeleteOptions
+	for name, target := range map[string]*bool{
+		"deleteData":            &opts.Data,
+		"deleteHls":             &opts.HLS,
+		"deletePieceCompletion": &opts.PieceCompletion,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s parameter: %q", name, value)
+		}
+		*target = parsed
+	}
+	return opts, nil
+}
+
 // ConvertTorrentHandler обрабатывает POST /{hash}/convert
 func ConvertTorrentHandler(service *torrent.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -152,3 +325,241 @@ func ConvertTorrentHandler(service *torrent.Service) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// GetTorrentFilesHandler обрабатывает GET /{hash}/files
+func GetTorrentFilesHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		files, err := service.GetTorrentFiles(hash)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(files); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// GetPieceMapHandler обрабатывает GET /{hash}/pieces
+func GetPieceMapHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		pieces, err := service.GetPieceMap(hash)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(pieces); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// SetFilePrioritiesHandler обрабатывает PUT /{hash}/files/priorities
+func SetFilePrioritiesHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		var req filePrioritiesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.SetFilePriorities(hash, req.Priorities); err != nil {
+			log.Printf("[api] Failed to set file priorities: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// SetDownloadModeHandler обрабатывает PUT /{hash}/download-mode
+func SetDownloadModeHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		var mode torrent.DownloadMode
+		decoder := json.NewDecoder(r.Body)
+		// Опечатка в названии режима иначе молча сбросила бы его
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&mode); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.SetDownloadMode(hash, mode); err != nil {
+			log.Printf("[api] Failed to set download mode: %v", err)
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// RecheckTorrentHandler обрабатывает POST /{hash}/recheck
+func RecheckTorrentHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.RecheckTorrent(hash); err != nil {
+			log.Printf("[api] Failed to start recheck: %v", err)
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrRecheckInProgress) || errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		// Проверка идёт в фоне, её ход виден в stats.recheck торрента
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// CreateTorrentHandler обрабатывает POST /create
+func CreateTorrentHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts torrent.CreateOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		created, err := service.CreateTorrent(opts)
+		if err != nil {
+			log.Printf("[api] Failed to create torrent: %v", err)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, torrent.ErrInvalidCreateOptions), errors.Is(err, torrent.ErrInvalidTrackerURL):
+				status = http.StatusBadRequest
+			case errors.Is(err, torrent.ErrSavePathNotAllowed):
+				status = http.StatusForbidden
+			case errors.Is(err, fs.ErrNotExist):
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		// Обрабатываем ошибку Encode
+		if err := json.NewEncoder(w).Encode(created); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+// GetMetaInfoHandler обрабатывает GET /{hash}/metainfo и отдаёт .torrent файл торрента
+func GetMetaInfoHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		mi, err := service.GetMetaInfo(hash)
+		if err != nil {
+			log.Printf("[api] Failed to get metainfo: %v", err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		name := hash
+		if info, err := mi.UnmarshalInfo(); err == nil && info.BestName() != "" {
+			name = info.BestName()
+		}
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".torrent"}))
+
+		if err := mi.Write(w); err != nil {
+			log.Printf("[api] Client disconnected before response: %v", err)
+		}
+	}
+}
+
+type moveStorageRequest struct {
+	SavePath string `json:"savePath"`
+}
+
+// MoveStorageHandler обрабатывает POST /{hash}/move
+func MoveStorageHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		var req moveStorageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.MoveStorage(hash, req.SavePath); err != nil {
+			log.Printf("[api] Failed to move torrent storage: %v", err)
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, torrent.ErrSavePathNotAllowed):
+				status = http.StatusForbidden
+			case errors.Is(err, torrent.ErrMoveInProgress), errors.Is(err, torrent.ErrNoMetadata):
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		// Перенос идёт в фоне, пока он выполняется, в stats.movingTo указана новая папка
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
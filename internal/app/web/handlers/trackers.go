@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"GoFlix/internal/app/torrent"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type trackersRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// GetTrackersHandler обрабатывает GET /{hash}/trackers
+func GetTrackersHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		trackers, err := service.GetTrackers(hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeTrackers(w, trackers)
+	}
+}
+
+// AddTrackersHandler обрабатывает POST /{hash}/trackers
+func AddTrackersHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		var req trackersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		trackers, err := service.AddTrackers(hash, req.URLs)
+		if err != nil {
+			writeTrackersError(w, err)
+			return
+		}
+		writeTrackers(w, trackers)
+	}
+}
+
+// RemoveTrackersHandler обрабатывает DELETE /{hash}/trackers?url=...&url=...
+func RemoveTrackersHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		trackers, err := service.RemoveTrackers(hash, r.URL.Query()["url"])
+		if err != nil {
+			writeTrackersError(w, err)
+			return
+		}
+		writeTrackers(w, trackers)
+	}
+}
+
+// ReannounceHandler обрабатывает POST /{hash}/reannounce
+func ReannounceHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+		if hash == "" {
+			http.Error(w, "Missing or invalid hash parameter", http.StatusBadRequest)
+			return
+		}
+
+		if err := service.Reannounce(hash); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// Анонсы идут в фоне, их результат виден в GET /{hash}/trackers
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func writeTrackersError(w http.ResponseWriter, err error) {
+	log.Printf("[api] Failed to edit trackers: %v", err)
+	status := http.StatusNotFound
+	if errors.Is(err, torrent.ErrInvalidTrackerURL) {
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeTrackers(w http.ResponseWriter, trackers []torrent.TrackerStatus) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Обрабатываем ошибку Encode
+	if err := json.NewEncoder(w).Encode(trackers); err != nil {
+		log.Printf("[api] Client disconnected before response: %v", err)
+	}
+}
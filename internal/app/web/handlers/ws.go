@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"GoFlix/internal/app/torrent"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"runtime/debug"
+	"slices"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
 )
 
@@ -53,3 +57,115 @@ func HandleWebSocket(torrentClient *torrent.Service) http.HandlerFunc {
 		}
 	}
 }
+
+// pieceMessage сообщение темы частей торрента: полная карта при подключении,
+// затем накопленные изменения состояний и доступность, когда она меняется
+type pieceMessage struct {
+	Type         string                    `json:"type"`
+	PieceMap     *torrent.PieceMap         `json:"pieceMap,omitempty"`
+	Changes      []torrent.PieceChange     `json:"changes,omitempty"`
+	Peers        *int                      `json:"peers,omitempty"`
+	Availability []torrent.AvailabilityRun `json:"availability,omitempty"`
+}
+
+// PiecesWebSocketHandler обрабатывает /ws/torrents/{hash}/pieces
+func PiecesWebSocketHandler(service *torrent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := chi.URLParam(r, "hash")
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Карта и поток изменений получены из одного снимка, поэтому изменения между ними не теряются
+		pieceMap, changes, err := service.WatchPieces(ctx, hash)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, torrent.ErrNoMetadata) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("[ws] Upgrade failed: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				log.Printf("[ws] Close error: %v", err)
+			}
+		}()
+
+		// Клиент ничего не присылает, чтение нужно только чтобы заметить отключение
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		if err := conn.WriteJSON(pieceMessage{Type: "map", PieceMap: &pieceMap}); err != nil {
+			log.Printf("[ws] Client disconnected: %v", err)
+			return
+		}
+
+		// Изменения отправляются пачками, чтобы не слать сообщение на каждую загруженную часть
+		flush := time.NewTicker(time.Second)
+		defer flush.Stop()
+		availability := time.NewTicker(5 * time.Second)
+		defer availability.Stop()
+
+		var pending []torrent.PieceChange
+		pendingIndex := make(map[int]int)
+		lastAvailability := pieceMap
+		for {
+			select {
+			case change, ok := <-changes:
+				if !ok {
+					// Торрент удалён из клиента
+					return
+				}
+				// В пачке остаётся только последнее состояние каждой части
+				if i, ok := pendingIndex[change.Index]; ok {
+					pending[i] = change
+					continue
+				}
+				pendingIndex[change.Index] = len(pending)
+				pending = append(pending, change)
+
+			case <-flush.C:
+				if len(pending) == 0 {
+					continue
+				}
+				if err := conn.WriteJSON(pieceMessage{Type: "changes", Changes: pending}); err != nil {
+					log.Printf("[ws] Client disconnected: %v", err)
+					return
+				}
+				pending = nil
+				clear(pendingIndex)
+
+			case <-availability.C:
+				current, err := service.GetPieceMap(hash)
+				if err != nil {
+					return
+				}
+				if current.Peers == lastAvailability.Peers && slices.Equal(current.Availability, lastAvailability.Availability) {
+					continue
+				}
+				lastAvailability = current
+				msg := pieceMessage{Type: "availability", Peers: &current.Peers, Availability: current.Availability}
+				if err := conn.WriteJSON(msg); err != nil {
+					log.Printf("[ws] Client disconnected: %v", err)
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}